@@ -0,0 +1,174 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Attributes flattens the error into a map suitable for tracing span event
+// attributes or structured logs:
+//
+//   - "error.message": the full message as returned by Error();
+//   - "error.type": the type of the root cause, e.g. "*fs.PathError";
+//   - "error.location": "file:line" of the outermost annotation, if any;
+//   - "error.function": the function of the outermost annotation, if any;
+//   - "error.stack": the rendered panic stack, if any (see FromPanic);
+//   - "error.tags": the tags (see Tags), if any;
+//   - "error.operation": the operation (see Operation), if any;
+//   - "error.fault": the fault as a string (see FaultOf), if known;
+//   - "error.fields.<key>": each of the fields (see Fields).
+//
+// Returns nil for a nil error.
+func Attributes(err error) map[string]any {
+	if err == nil {
+		return nil
+	}
+	attrs := map[string]any{
+		"error.message": err.Error(),
+		"error.type":    fmt.Sprintf("%T", rootCause(err)),
+	}
+	walk(err, func(e error) bool {
+		if a, ok := e.(*annotatedError); ok && a.frame != (Frame{}) {
+			attrs["error.location"] = fmt.Sprintf("%s:%d", a.frame.File, a.frame.Line)
+			attrs["error.function"] = a.frame.Function
+			return true
+		}
+		return false
+	})
+	if stack := StackTrace(err); stack != nil {
+		attrs["error.stack"] = DefaultRenderer.RenderStack(stack)
+	}
+	if tags := Tags(err); tags != nil {
+		attrs["error.tags"] = tags
+	}
+	if op, ok := Operation(err); ok {
+		attrs["error.operation"] = op
+	}
+	if f := FaultOf(err); f != UnknownFault {
+		attrs["error.fault"] = f.String()
+	}
+	for k, v := range Fields(err) {
+		attrs["error.fields."+k] = v
+	}
+	return attrs
+}
+
+// MetadataJSON marshals the structured metadata merged across err's chain,
+// without the message and the stack, e.g. for log schemas keeping the free
+// text and the structured data in separate fields:
+//
+//	{"fields":{"user":"joe"},"tags":["db"],"operation":"CreateUser"}
+//
+// The keys are "fields" (see Fields), "tags" (see Tags), "operation" (see
+// Operation), "fault" (see FaultOf, as a string, unless unknown), "endpoint"
+// (see Endpoint), "sample_key" (see SampleKey), "duration" (see DurationOf, as
+// a string such as "1.5s"), "progress" (see Progress), "score" (see ScoreOf)
+// and "attempts" (see Attempts), each present only when set. Returns "{}" when
+// there is no metadata, including for a nil error. An error is returned if some
+// field value cannot be marshaled.
+func MetadataJSON(err error) ([]byte, error) {
+	m := make(map[string]any)
+	if fields := Fields(err); fields != nil {
+		m["fields"] = fields
+	}
+	if tags := Tags(err); tags != nil {
+		m["tags"] = tags
+	}
+	if op, ok := Operation(err); ok {
+		m["operation"] = op
+	}
+	if f := FaultOf(err); f != UnknownFault {
+		m["fault"] = f.String()
+	}
+	if ep, ok := Endpoint(err); ok {
+		m["endpoint"] = ep
+	}
+	if key, ok := SampleKey(err); ok {
+		m["sample_key"] = key
+	}
+	if d, ok := DurationOf(err); ok {
+		m["duration"] = d.String()
+	}
+	if n, ok := Progress(err); ok {
+		m["progress"] = n
+	}
+	if score, ok := ScoreOf(err); ok {
+		m["score"] = score
+	}
+	if n := Attempts(err); n > 0 {
+		m["attempts"] = n
+	}
+	return json.Marshal(m)
+}
+
+// ErrorInfo is the information about an error commonly needed together, e.g.
+// by a request handler rendering a response.
+type ErrorInfo struct {
+	Message  string         // the outermost message, as returned by Brief
+	Fields   map[string]any // the merged fields, as returned by Fields
+	Location Frame          // the outermost known annotation location, if any
+}
+
+// Info collects the ErrorInfo from err's chain in a single pass. Returns zero
+// ErrorInfo for a nil error.
+func Info(err error) ErrorInfo {
+	var info ErrorInfo
+	if err == nil {
+		return info
+	}
+	hasMessage := false
+	walk(err, func(e error) bool {
+		switch v := e.(type) {
+		case *annotatedError:
+			if !hasMessage && v.stack == nil {
+				if msg := v.message(); msg != "" {
+					info.Message, hasMessage = msg, true
+				}
+			}
+			if info.Location == (Frame{}) {
+				info.Location = v.frame
+			}
+			for k, val := range v.fields {
+				if info.Fields == nil {
+					info.Fields = make(map[string]any)
+				}
+				if _, ok := info.Fields[k]; !ok {
+					info.Fields[k] = val
+				}
+			}
+		case *valueError:
+		default:
+			if !hasMessage {
+				info.Message, hasMessage = Brief(e), true
+			}
+		}
+		return false
+	})
+	info.Fields = addDefaultFields(info.Fields)
+	return info
+}
+
+// rootCause returns the innermost error of err's Unwrap() error chain.
+func rootCause(err error) error {
+	for {
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok || u.Unwrap() == nil {
+			return err
+		}
+		err = u.Unwrap()
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAttributes(t *testing.T) {
+	Convey("Attributes works", t, func() {
+		Convey("nil", func() {
+			So(Attributes(nil), ShouldBeNil)
+		})
+
+		Convey("foreign error", func() {
+			So(Attributes(myError("mine")), ShouldResemble, map[string]any{
+				"error.message": "mine",
+				"error.type":    "errors.myError",
+			})
+		})
+
+		Convey("annotated error with metadata", func() {
+			inner := AnnotateWithFields(&ptrError{msg: "mine"}, map[string]any{"a": 1}, "inner")
+			err := WithFault(WithOperation(ann(WithTags(inner, "db"), "outer"), "Op"), UserFault)
+			attrs := Attributes(err)
+			So(attrs["error.message"], ShouldEqual, err.Error())
+			So(attrs["error.type"], ShouldEqual, "*errors.ptrError")
+			So(strings.HasSuffix(attrs["error.location"].(string), "/errors_test.go:31"), ShouldBeTrue)
+			So(attrs["error.function"], ShouldEqual, "github.com/stockparfait/errors.ann")
+			So(attrs["error.tags"], ShouldResemble, []string{"db"})
+			So(attrs["error.operation"], ShouldEqual, "Op")
+			So(attrs["error.fault"], ShouldEqual, "user")
+			So(attrs["error.fields.a"], ShouldEqual, 1)
+			So(attrs, ShouldNotContainKey, "error.stack")
+		})
+
+		Convey("recovered panic", func() {
+			attrs := Attributes(fnA("error"))
+			So(attrs["error.stack"], ShouldContainSubstring, "PANIC: ")
+			So(attrs["error.function"], ShouldEqual, "github.com/stockparfait/errors.fnC")
+		})
+	})
+
+	Convey("MetadataJSON works", t, func() {
+		Convey("no metadata", func() {
+			for _, err := range []error{nil, rsn("because"), myError("mine")} {
+				js, jsErr := MetadataJSON(err)
+				So(jsErr, ShouldBeNil)
+				So(string(js), ShouldEqual, "{}")
+			}
+		})
+
+		Convey("merged metadata", func() {
+			var err error = AnnotateWithFields(rsn("because"), map[string]any{"user": "joe"}, "failed")
+			err = AnnotateDuration(WithEndpoint(err, "db:5432"), 1500*time.Millisecond, "slow")
+			err = AnnotateProgress(err, 4096, "partial")
+			err = WithAttempt(WithScore(WithSampleKey(WithTags(err, "db"), "k"), 50), 2)
+			err = WithFault(WithOperation(ann(err, "annotated"), "CreateUser"), DependencyFault)
+			js, jsErr := MetadataJSON(err)
+			So(jsErr, ShouldBeNil)
+			So(string(js), ShouldEqual, `{"attempts":2,"duration":"1.5s","endpoint":"db:5432","fault":"dependency",`+
+				`"fields":{"user":"joe"},"operation":"CreateUser","progress":4096,"sample_key":"k",`+
+				`"score":50,"tags":["db"]}`)
+		})
+
+		Convey("unsupported field value", func() {
+			err := AnnotateWithFields(rsn("because"), map[string]any{"f": func() {}}, "failed")
+			_, jsErr := MetadataJSON(err)
+			So(jsErr, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Info works", t, func() {
+		So(Info(nil), ShouldResemble, ErrorInfo{})
+		So(Info(myError("mine")), ShouldResemble, ErrorInfo{Message: "mine"})
+
+		inner := AnnotateWithFields(rsn("because"), map[string]any{"a": 1, "b": 1}, "")
+		err := AnnotateWithFields(WithTags(ann(inner, ""), "db"), map[string]any{"a": 2}, "")
+		info := Info(err)
+		So(info.Message, ShouldEqual, "because")
+		So(info.Message, ShouldEqual, Brief(err))
+		So(info.Fields, ShouldResemble, Fields(err))
+		So(info.Location.Function, ShouldStartWith, "github.com/stockparfait/errors.TestAttributes")
+		So(Info(ann(fnA("error"), "")).Message, ShouldEqual, "error in fnC")
+		So(Info(fmt.Errorf("ctx: %w", rsn("root"))).Message, ShouldEqual, "ctx: root")
+	})
+}
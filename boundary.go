@@ -0,0 +1,71 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// ErrInternal is matched (using Is) by all the external errors returned by
+// Boundary.
+var ErrInternal = Const("internal error")
+
+// boundaryError is a sanitized error safe to expose outside of a service.
+type boundaryError struct {
+	id string
+}
+
+// Error implements error.
+func (e *boundaryError) Error() string {
+	return ErrInternal.Error() + " (ref " + e.id + ")"
+}
+
+// Unwrap returns ErrInternal.
+func (e *boundaryError) Unwrap() error {
+	return ErrInternal
+}
+
+// newID generates a random reference ID.
+func newID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil { // shouldn't happen, defensive code
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// Boundary converts an internal error into a minimal external error
+// "internal error (ref <id>)" with a newly generated unique id, e.g. to be
+// returned from a public API. The caller is expected to log the full internal
+// error together with the id, to correlate it with the external error:
+//
+//	if err := handle(req); err != nil {
+//	  ext, id := errors.Boundary(err)
+//	  log.Printf("request failed, ref %s: %s", id, err.Error())
+//	  return ext
+//	}
+//
+// The external error matches ErrInternal using Is, and does not expose the
+// internal error in any way. If err is nil, returns nil and an empty id.
+func Boundary(err error) (external error, id string) {
+	if err == nil {
+		return nil, ""
+	}
+	id = newID()
+	return &boundaryError{id: id}, id
+}
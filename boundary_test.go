@@ -0,0 +1,46 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBoundary(t *testing.T) {
+	Convey("Boundary works", t, func() {
+		Convey("nil stays nil", func() {
+			ext, id := Boundary(nil)
+			So(ext, ShouldBeNil)
+			So(id, ShouldEqual, "")
+		})
+
+		Convey("hides the internal error", func() {
+			root := myError("secret")
+			ext, id := Boundary(ann(root, "failed"))
+			So(id, ShouldHaveLength, 16)
+			So(ext.Error(), ShouldEqual, "internal error (ref "+id+")")
+			So(Is(ext, ErrInternal), ShouldBeTrue)
+			So(Is(ext, root), ShouldBeFalse)
+		})
+
+		Convey("generates unique IDs", func() {
+			_, id1 := Boundary(rsn("a"))
+			_, id2 := Boundary(rsn("a"))
+			So(id1, ShouldNotEqual, id2)
+		})
+	})
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+// Builder constructs an error with metadata in a single expression:
+//
+//	return errors.Build("cannot read %s", name).Field("size", n).Tags("io").Err()
+//
+// The location is captured by Build or BuildFrom, not by Err.
+type Builder struct {
+	err  *annotatedError // nil when built from a nil error
+	tags []string
+}
+
+// Build starts building a new error with the caller's location and the message
+// formatted as fmt.Printf(s, args...).
+func Build(s string, args ...any) *Builder {
+	return &Builder{err: annotate(nil, 2, s, args...)}
+}
+
+// BuildFrom starts building an annotation of err, as Annotate does. If err is
+// nil, all the Builder methods are no-op, and Err returns nil.
+func BuildFrom(err error, s string, args ...any) *Builder {
+	if err == nil {
+		return &Builder{}
+	}
+	return &Builder{err: annotate(err, 2, s, args...)}
+}
+
+// Field attaches a key-value field to the error (see Fields).
+func (b *Builder) Field(key string, value any) *Builder {
+	if b.err == nil {
+		return b
+	}
+	if b.err.fields == nil {
+		b.err.fields = make(map[string]any)
+	}
+	b.err.fields[key] = value
+	return b
+}
+
+// Tags attaches the tags to the error (see Tags).
+func (b *Builder) Tags(tags ...string) *Builder {
+	if b.err == nil {
+		return b
+	}
+	b.tags = append(b.tags, tags...)
+	return b
+}
+
+// Err returns the constructed error, or nil if the Builder was started from a
+// nil error. The error is immutable: further calls to the Builder methods do
+// not affect it.
+func (b *Builder) Err() error {
+	if b.err == nil {
+		return nil
+	}
+	res := *b.err
+	if b.err.fields != nil {
+		res.fields = make(map[string]any, len(b.err.fields))
+		for k, v := range b.err.fields {
+			res.fields[k] = v
+		}
+	}
+	return WithTags(&res, b.tags...)
+}
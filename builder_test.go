@@ -0,0 +1,64 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBuilder(t *testing.T) {
+	Convey("Builder works", t, func() {
+		Convey("for a new error", func() {
+			line := curLine() + 1
+			b := Build("failed %d", 1)
+			err := b.Field("a", 1).Field("b", "x").Tags("db", "io").Err()
+			So(err.Error(), ShouldContainSubstring, "builder_test.go:")
+			So(err.Error(), ShouldContainSubstring, "TestBuilder")
+			So(err.Error(), ShouldEndWith, "() failed 1")
+			So(err.(*valueError).orig.(*annotatedError).frame.Line, ShouldEqual, line)
+			So(Fields(err), ShouldResemble, map[string]any{"a": 1, "b": "x"})
+			So(Tags(err), ShouldResemble, []string{"db", "io"})
+		})
+
+		Convey("returns an immutable error", func() {
+			b := Build("failed").Field("a", 1).Tags("db")
+			err := b.Err()
+			b.Field("a", 2).Field("b", 2).Tags("io")
+			So(Fields(err), ShouldResemble, map[string]any{"a": 1})
+			So(Tags(err), ShouldResemble, []string{"db"})
+			So(Fields(b.Err()), ShouldResemble, map[string]any{"a": 2, "b": 2})
+		})
+
+		Convey("without metadata", func() {
+			err := Build("plain").Err()
+			So(Fields(err), ShouldBeNil)
+			So(Tags(err), ShouldBeNil)
+		})
+
+		Convey("for an annotation", func() {
+			root := myError("root")
+			err := BuildFrom(root, "failed").Field("a", 1).Err()
+			So(Is(err, root), ShouldBeTrue)
+			So(err.Error(), ShouldEndWith, "() failed\nroot")
+			So(Fields(err), ShouldResemble, map[string]any{"a": 1})
+		})
+
+		Convey("for a nil error", func() {
+			So(BuildFrom(nil, "failed").Field("a", 1).Tags("db").Err(), ShouldBeNil)
+		})
+	})
+}
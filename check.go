@@ -0,0 +1,51 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Overridden in tests.
+var (
+	exit             = os.Exit
+	stderr io.Writer = os.Stderr
+)
+
+// Check prints the error to stderr and exits the program with status 1 when
+// err is not nil. It is intended as a one-line top-level error handler in
+// main() of CLI tools and scripts:
+//
+//	func main() {
+//	  errors.Check(run())
+//	}
+func Check(err error) {
+	if err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		exit(1)
+	}
+}
+
+// CheckCtx is the same as Check, and additionally exits when the context is
+// done, reporting ctx.Err() annotated with the caller's location.
+func CheckCtx(ctx context.Context, err error) {
+	if err == nil {
+		err = AnnotateStack(ctx.Err(), 3, "context is done")
+	}
+	Check(err)
+}
@@ -0,0 +1,68 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCheck(t *testing.T) {
+	Convey("Check works", t, func() {
+		var buf bytes.Buffer
+		code := -1
+		stderr = &buf
+		exit = func(c int) { code = c }
+		defer func() {
+			stderr = os.Stderr
+			exit = os.Exit
+		}()
+
+		Convey("no-op on nil", func() {
+			Check(nil)
+			So(code, ShouldEqual, -1)
+			So(buf.String(), ShouldEqual, "")
+		})
+
+		Convey("prints the error and exits", func() {
+			err := rsn("because")
+			Check(err)
+			So(code, ShouldEqual, 1)
+			So(buf.String(), ShouldEqual, err.Error()+"\n")
+		})
+
+		Convey("CheckCtx respects the error", func() {
+			CheckCtx(context.Background(), rsn("because"))
+			So(code, ShouldEqual, 1)
+			So(buf.String(), ShouldContainSubstring, "because")
+		})
+
+		Convey("CheckCtx respects the context", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			CheckCtx(ctx, nil)
+			So(code, ShouldEqual, -1)
+
+			cancel()
+			CheckCtx(ctx, nil)
+			So(code, ShouldEqual, 1)
+			So(buf.String(), ShouldContainSubstring, "check_test.go:62: ")
+			So(buf.String(), ShouldContainSubstring, "context is done\ncontext canceled")
+		})
+	})
+}
@@ -0,0 +1,31 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !plan9
+
+package errors
+
+import (
+	"syscall"
+)
+
+// Errno returns the syscall.Errno found in err's "Unwrap" chain, e.g. to check
+// the raw error number of a failed system call wrapped by os.PathError and
+// further annotated.
+func Errno(err error) (syscall.Errno, bool) {
+	if e, ok := AsType[syscall.Errno](err); ok {
+		return *e, true
+	}
+	return 0, false
+}
@@ -0,0 +1,43 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !plan9
+
+package errors
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestErrno(t *testing.T) {
+	Convey("Errno works", t, func() {
+		Convey("finds the errno", func() {
+			_, err := os.Open("/nonexistent/file")
+			errno, ok := Errno(ann(err, "cannot open"))
+			So(ok, ShouldBeTrue)
+			So(errno, ShouldEqual, syscall.ENOENT)
+		})
+
+		Convey("when there is none", func() {
+			_, ok := Errno(ann(myError("mine"), "annotated"))
+			So(ok, ShouldBeFalse)
+			_, ok = Errno(nil)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
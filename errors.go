@@ -25,6 +25,15 @@
 //	if err := MyFunc(val); err != nil {
 //	  return errors.Annotate(err, "cannot use %d", val)
 //	}
+//
+// Messages are formatted lazily, only when the error is rendered, therefore the
+// formatting arguments must not be modified after the error is created.
+//
+// Creating errors is cheap enough for hot error-handling paths: Reason with a
+// constant message makes at most 3 allocations (2 of which are in
+// runtime.Caller), and Annotate with formatting arguments makes at most 4.
+// Error() renders the whole chain into a single buffer. These budgets are
+// enforced by tests, and the benchmarks in errors_test.go track them.
 package errors
 
 import (
@@ -32,52 +41,261 @@ import (
 	"fmt"
 	"runtime"
 	"strings"
+	"sync"
 )
 
 // annotatedError annotates the original error with the current message.
 type annotatedError struct {
-	orig error
-	curr string
+	orig    error
+	frame   Frame          // location of the annotation, zero if unknown
+	format  string         // message template, as for fmt.Printf
+	args    []any          // message arguments
+	stack   []Frame        // panic call stack, non-nil for errors produced by FromPanic
+	skip    int            // requested stack level when the frame could not be found
+	origin  *origin        // host and process, when CaptureOrigin is enabled
+	fields  map[string]any // key-value metadata, see AnnotateWithFields
+	onceKey string         // idempotency key, see AnnotateOnce
+	repeats int            // number of identical annotations collapsed into this one
+	also    error          // secondary error, see AnnotateDeferred
+	lazy    *lazyMessage   // message generator replacing format, see LazyReason
+	literal bool           // format is the message as is, not a template
 }
 
-// Error implements error.
-func (e annotatedError) Error() string {
-	if e.orig == nil {
-		return e.curr
+// lazyTemplate is the message template of all the errors created by
+// LazyReason, whose messages are not known in advance.
+const lazyTemplate = "<lazy>"
+
+// lazyMessage generates the message once, when first needed.
+type lazyMessage struct {
+	once sync.Once
+	f    func() string
+	msg  string
+}
+
+func (l *lazyMessage) get() string {
+	l.once.Do(func() {
+		l.msg = l.f()
+		l.f = nil
+	})
+	return l.msg
+}
+
+// Error implements error. Like the other methods of annotatedError, it is safe
+// to call on a nil pointer wrapped in a non-nil error interface, in which case
+// the message is empty.
+func (e *annotatedError) Error() string {
+	if e == nil {
+		return ""
 	}
-	return fmt.Sprintf("%s\n%s", e.curr, e.orig.Error())
+	return DefaultRenderer.RenderError(e)
+}
+
+// String implements fmt.Stringer, and is the same as Error(). This keeps the
+// output consistent for loggers which prefer String() over Error().
+func (e *annotatedError) String() string {
+	return e.Error()
 }
 
 // Unwrap returns the original error being annotated. See also As and Is methods.
-func (e annotatedError) Unwrap() error {
+func (e *annotatedError) Unwrap() error {
+	if e == nil {
+		return nil
+	}
 	return e.orig
 }
 
-// annotate must be called from ReasonStack or AnnotateStack only.
-func annotate(stack int, s string, args ...any) string {
+// Is reports whether the secondary error, if any, matches target. Together with
+// Unwrap, this makes both errors of AnnotateDeferred visible to Is.
+func (e *annotatedError) Is(target error) bool {
+	return e != nil && e.also != nil && errors.Is(e.also, target)
+}
+
+// As finds the first error in the secondary error's chain, if any, that matches
+// target. Together with Unwrap, this makes both errors of AnnotateDeferred
+// visible to As.
+func (e *annotatedError) As(target any) bool {
+	return e != nil && e.also != nil && errors.As(e.also, target)
+}
+
+// constError is a comparable error value without location.
+type constError string
+
+// Error implements error.
+func (e constError) Error() string {
+	return string(e)
+}
+
+// Const returns a comparable error value with the given message and no
+// location. Two Const errors with the same message are equal (==), which makes
+// them suitable for sentinel errors used in switch statements and direct
+// comparisons:
+//
+//	var ErrNotFound = errors.Const("not found")
+//
+//	switch err {
+//	case ErrNotFound:
+//	  ...
+//	}
+//
+// The result can be annotated as any other error, and the sentinel can be
+// matched in the annotated chain using Is. Const is intended for sentinels
+// only; use Reason for dynamic errors.
+func Const(msg string) error {
+	return constError(msg)
+}
+
+// quietError is a comparable error value which logging code should skip.
+type quietError string
+
+// Error implements error.
+func (e quietError) Error() string {
+	return string(e)
+}
+
+// Quiet returns a comparable error value with the given message, marked so that
+// logging code can skip it using IsQuiet. It is intended for sentinels of
+// expected control flow, such as a custom EOF, which should never appear in
+// logs. As with Const, two Quiet errors with the same message are equal, and
+// can be matched in an annotated chain using Is.
+func Quiet(msg string) error {
+	return quietError(msg)
+}
+
+// IsQuiet reports whether err's chain contains an error created by Quiet.
+func IsQuiet(err error) bool {
+	return walk(err, func(e error) bool {
+		_, ok := e.(quietError)
+		return ok
+	})
+}
+
+// message formats the annotation message. An empty or whitespace-only message
+// is rendered as "".
+func (e *annotatedError) message() string {
+	msg := e.format
+	switch {
+	case e.lazy != nil:
+		msg = e.lazy.get()
+	case e.literal:
+	// Fast path: avoid formatting when there is nothing to format.
+	case len(e.args) > 0 || strings.IndexByte(msg, '%') >= 0:
+		msg = fmt.Sprintf(msg, formatArgs(e.args)...)
+		if strictFormat.get() && strings.Contains(msg, "%!") {
+			msg += " " + formattingErrorMarker
+		}
+	}
+	if strings.TrimSpace(msg) == "" {
+		return ""
+	}
+	return msg
+}
+
+// newAnnotation creates an annotation of orig without location.
+func newAnnotation(orig error, s string, args ...any) *annotatedError {
+	e := &annotatedError{orig: orig, format: s, args: args}
+	if captureOrigin.get() {
+		e.origin = currentOrigin()
+	}
+	countTemplate(s)
+	return e
+}
+
+var (
+	wrappersMu sync.RWMutex
+	wrappers   map[string]bool
+)
+
+// MarkWrapper registers functions, by their fully qualified names such as
+// "github.com/me/log.Errorf", as transparent wrappers: when an annotation's
+// location falls into such a function, its caller's location is used instead.
+// This lets logging and error helpers create errors with the location of their
+// callers without passing stack levels to ReasonStack or AnnotateStack. It is
+// intended to be called at program initialization.
+func MarkWrapper(functions ...string) {
+	wrappersMu.Lock()
+	defer wrappersMu.Unlock()
+	if wrappers == nil {
+		wrappers = make(map[string]bool)
+	}
+	for _, f := range functions {
+		wrappers[f] = true
+	}
+}
+
+// isWrapper reports whether the function is registered by MarkWrapper.
+func isWrapper(function string) bool {
+	wrappersMu.RLock()
+	defer wrappersMu.RUnlock()
+	return wrappers[function]
+}
+
+// annotate must be called from ReasonStack or AnnotateStack only. Negative
+// stack levels are rejected, and when the frame cannot be found, the requested
+// level is recorded to be shown in place of the location. Frames of the
+// functions registered by MarkWrapper are skipped.
+func annotate(orig error, stack int, s string, args ...any) *annotatedError {
+	e := newAnnotation(orig, s, args...)
 	// Frame 2 is the caller of Reason / Annotate.
-	pc, filename, line, ok := runtime.Caller(stack)
-	a := "ERROR: ???: "
-	if ok {
-		a = fmt.Sprintf("ERROR: %s:%d: %s() ", filename, line, runtime.FuncForPC(pc).Name())
+	for stack >= 0 {
+		pc, filename, line, ok := runtime.Caller(stack)
+		if !ok {
+			break
+		}
+		function := runtime.FuncForPC(pc).Name()
+		if isWrapper(function) {
+			stack++
+			continue
+		}
+		e.frame = Frame{File: filename, Line: line, Function: function}
+		return e
+	}
+	e.skip = stack
+	return e
+}
+
+// annotatePC annotates orig with the location of the program counter pc.
+func annotatePC(orig error, pc uintptr, s string, args ...any) *annotatedError {
+	e := newAnnotation(orig, s, args...)
+	if f := runtime.FuncForPC(pc); f != nil {
+		file, line := f.FileLine(pc)
+		e.frame = Frame{File: file, Line: line, Function: f.Name()}
+	}
+	return e
+}
+
+// dedup returns the new annotation a of the error e, unless DedupAnnotations is
+// enabled and e is an annotation with the same message, in which case the
+// repeat counter of (a copy of) e is incremented instead.
+func dedup(e error, a *annotatedError) error {
+	if dedupAnnotations.get() {
+		if prev, ok := e.(*annotatedError); ok && prev != nil && prev.stack == nil && prev.message() == a.message() {
+			dup := *prev
+			dup.repeats++
+			return &dup
+		}
 	}
-	return a + fmt.Sprintf(s, args...)
+	return a
 }
 
 // ReasonStack returns an error annotated with location `stack` levels up, and
-// message. Its arguments are the same as for fmt.Printf.
+// message. Its arguments are the same as for fmt.Printf. If `stack` is negative
+// or exceeds the call stack depth, the location is rendered as "???(stack=N):".
 func ReasonStack(stack int, s string, args ...any) error {
-	return &annotatedError{curr: annotate(stack, s, args...)}
+	return annotate(nil, stack, s, args...)
 }
 
 // AnnotateStack annotates the existing error with location `stack` levels up,
 // and message, formatted as fmt.Printf(s, args...). If the original error is
 // nil, returns nil.
+//
+// When DedupAnnotations is enabled and e is itself an annotation with the same
+// message, the repeat counter of e is incremented instead of adding a new
+// layer.
 func AnnotateStack(e error, stack int, s string, args ...any) error {
 	if e == nil {
 		return nil
 	}
-	return &annotatedError{orig: e, curr: annotate(stack, s, args...)}
+	return dedup(e, annotate(e, stack, s, args...))
 }
 
 // Reason returns an error annotated with location and message. Its arguments
@@ -88,10 +306,113 @@ func Reason(s string, args ...any) error {
 
 // Annotate the existing error with location and message, formatted as
 // fmt.Printf(s, args...). If the original error is nil, returns nil.
+//
+// An empty or whitespace-only message adds a location-only layer, rendered as
+// "ERROR: file:line: func()" without any trailing text.
 func Annotate(e error, s string, args ...any) error {
 	return AnnotateStack(e, 3, s, args...)
 }
 
+// AnnotateAll annotates err with each of the messages as a separate layer,
+// all with the caller's location. The messages are applied in order, as by
+// successive calls to Annotate, so the first message is the innermost, and the
+// last one is the outermost:
+//
+//	errors.AnnotateAll(err, "step 3", "operation X", "module Y")
+//
+// Note, that the messages are not format strings. If err is nil, returns nil.
+func AnnotateAll(err error, msgs ...string) error {
+	if err == nil {
+		return nil
+	}
+	for _, msg := range msgs {
+		a := annotate(err, 2, msg)
+		a.literal = true
+		err = a
+	}
+	return err
+}
+
+// AnnotateOnce is the same as Annotate, unless an annotation with the same key
+// was already applied to err's chain by AnnotateOnce, in which case err is
+// returned unchanged. This makes annotations by cross-cutting wrappers, which
+// may run more than once, idempotent.
+func AnnotateOnce(err error, key string, s string, args ...any) error {
+	if err == nil {
+		return nil
+	}
+	applied := walk(err, func(e error) bool {
+		a, ok := e.(*annotatedError)
+		return ok && a.onceKey == key
+	})
+	if applied {
+		return err
+	}
+	a := annotate(err, 2, s, args...)
+	a.onceKey = key
+	return a
+}
+
+// Here returns the program counter of its caller, to be used with AnnotateAt.
+//
+//go:noinline
+func Here() uintptr {
+	pc, _, _, ok := runtime.Caller(1)
+	if !ok { // shouldn't happen, defensive code
+		return 0
+	}
+	return pc
+}
+
+// AnnotateAt is the same as Annotate, but uses the location of the program
+// counter pc rather than of its caller. This allows a central handler or a
+// decorator to annotate errors with the location where the annotation
+// semantically belongs, captured earlier by Here():
+//
+//	pc := errors.Here()
+//	...
+//	return errors.AnnotateAt(err, pc, "failed to process %s", name)
+//
+// An invalid pc results in an unknown location "???:".
+func AnnotateAt(err error, pc uintptr, s string, args ...any) error {
+	if err == nil {
+		return nil
+	}
+	return dedup(err, annotatePC(err, pc, s, args...))
+}
+
+// LazyReason returns an error with the caller's location and the message
+// generated by f only when it is first needed, e.g. when the error is rendered.
+// This minimizes the work for errors on hot paths which are mostly handled
+// without ever being rendered. The location is captured immediately. The
+// function f must be pure and safe to call from any goroutine; it is called at
+// most once. Since f is not called for templates, all lazy errors share the
+// template "<lazy>" in Summary, SameTemplate, Fingerprint and Metrics.
+func LazyReason(f func() string) error {
+	e := annotate(nil, 2, lazyTemplate)
+	e.lazy = &lazyMessage{f: f}
+	return e
+}
+
+// ReasonPC is the same as Reason, but uses the location of the program counter
+// pc rather than of its caller. It is a low-level building block for logging
+// decorators and other wrappers which need to report their caller's location.
+// The pc can be obtained by Here() or runtime.Caller in the desired function,
+// or by runtime.Callers in a wrapper:
+//
+//	func Failf(s string, args ...any) error {
+//	  var pcs [1]uintptr
+//	  runtime.Callers(2, pcs[:]) // the caller of Failf
+//	  return errors.ReasonPC(pcs[0]-1, s, args...)
+//	}
+//
+// Note, that runtime.Callers returns return addresses, which may belong to the
+// next line; subtracting 1 gives the location of the call itself. An invalid pc
+// results in an unknown location "???:". See also MarkWrapper.
+func ReasonPC(pc uintptr, s string, args ...any) error {
+	return annotatePC(nil, pc, s, args...)
+}
+
 // ReasonPanic is equivalent to panic(Reason(s, args...)).  This allows using
 // panic as an exception for error handling.  See also FromPanic for converting
 // such panic back into error.
@@ -106,6 +427,147 @@ func AnnotatePanic(e error, s string, args ...any) {
 	}
 }
 
+// Invariant panics with an error at the caller's location and the message
+// formatted as fmt.Printf(s, args...) when cond is false, as ReasonPanic does.
+// It is intended for fail-fast checks of internal invariants which should never
+// be violated. See also FromPanic for recovering such panics.
+func Invariant(cond bool, s string, args ...any) {
+	if !cond {
+		panic(ReasonStack(3, s, args...))
+	}
+}
+
+// Require is the same as Annotate, but it panics with an annotated error (see
+// ReasonPanic) when err is nil. Use it on code paths where the error is known
+// to be non-nil, to catch logic errors violating this assumption.
+func Require(err error, s string, args ...any) error {
+	if err == nil {
+		panic(ReasonStack(3, "unexpected nil error: "+s, args...))
+	}
+	return AnnotateStack(err, 3, s, args...)
+}
+
+// Assert returns nil when cond is true, and otherwise an error with the
+// caller's location and the message formatted as fmt.Printf(s, args...). It is
+// intended for validation sequences:
+//
+//	if err := errors.Assert(x > 0, "x must be positive, got %d", x); err != nil {
+//	  return err
+//	}
+func Assert(cond bool, s string, args ...any) error {
+	if cond {
+		return nil
+	}
+	return ReasonStack(3, s, args...)
+}
+
+// FirstError returns the first non-nil error of errs annotated with its index
+// in the list, e.g. to pinpoint which of several attempts failed. Returns nil if
+// all the errors are nil.
+func FirstError(errs ...error) error {
+	for i, err := range errs {
+		if err != nil {
+			return annotate(err, 2, "error at index %d", i)
+		}
+	}
+	return nil
+}
+
+// AnnotateDeferred runs f, and if it returns an error, records it in *primary
+// annotated with msg, without dropping either error. It is intended for cleanup
+// in defer:
+//
+//	func Foo() (err error) {
+//	  f, err := os.Create(name)
+//	  ...
+//	  defer errors.AnnotateDeferred(&err, f.Close, "cannot close "+name)
+//	  ...
+//	}
+//
+// If *primary is nil, it is set to the error of f annotated with msg. Otherwise
+// *primary is annotated with msg, and the error of f is attached to it as a
+// secondary error, as by AnnotateWith2. The location is that of the function
+// exit which runs the deferred call. Note, that msg is not a format string.
+func AnnotateDeferred(primary *error, f func() error, msg string) {
+	err := f()
+	if err == nil {
+		return
+	}
+	if *primary == nil {
+		e := annotate(err, 2, msg)
+		e.literal = true
+		*primary = e
+		return
+	}
+	e := annotate(*primary, 2, msg)
+	e.literal = true
+	e.also = err
+	*primary = e
+}
+
+// AnnotateWith2 is the same as Annotate, and additionally attaches a secondary
+// error, e.g. when an operation fails, and then its rollback also fails. The
+// secondary error is rendered after the primary chain in an "(also: ...)" note,
+// and both errors are matched by Is and As. If secondary is nil, it is exactly
+// as Annotate. If primary is nil, returns nil.
+func AnnotateWith2(primary, secondary error, s string, args ...any) error {
+	if secondary == nil {
+		return AnnotateStack(primary, 3, s, args...)
+	}
+	if primary == nil {
+		return nil
+	}
+	e := annotate(primary, 2, s, args...)
+	e.also = secondary
+	return e
+}
+
+type goroutineDumpKey struct{}
+
+// FromPanicFull is the same as FromPanic, and additionally attaches the stacks
+// of all the goroutines, as printed by runtime.Stack, to the recovered error.
+// The dump may be very large, and is not included in Error(); use
+// GoroutineDump to retrieve it. It is intended for debugging the worst
+// production incidents:
+//
+//	defer func() { err = errors.FromPanicFull(recover()) }()
+func FromPanicFull(p any) error {
+	err := FromPanic(p)
+	if !FromPanicOrigin(err) {
+		return err
+	}
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	return withValue(err, goroutineDumpKey{}, string(buf))
+}
+
+// GoroutineDump returns the dump of all the goroutines attached to err's chain
+// by FromPanicFull, if any.
+func GoroutineDump(err error) (string, bool) {
+	v, ok := lookup(err, goroutineDumpKey{})
+	if !ok {
+		return "", false
+	}
+	return v.(string), true
+}
+
+// inPanic reports whether the frames contain an active panic.
+func inPanic(frames []runtime.Frame) bool {
+	for _, f := range frames {
+		if f.Function == "runtime.gopanic" {
+			return true
+		}
+	}
+	return false
+}
+
 // trimFrames to keep only the portion from panic to the top user main(). If in
 // doubt, keep the frames.
 func trimFrames(frames []runtime.Frame) []runtime.Frame {
@@ -124,52 +586,289 @@ func trimFrames(frames []runtime.Frame) []runtime.Frame {
 	return frames
 }
 
-// FromPanic converts an intentional panic back to error and annotates it with
-// the panic call stack. Other panics are re-raised. It is intended to be used
-// in defer:
+// FromPanic converts an intentional panic, i.e. one with an error of this
+// package or of a type registered by RegisterPanicType, back to error and
+// annotates it with the panic call stack. Other panics are re-raised. It is
+// intended to be used in defer:
 //
 //	func Foo() (err error) {
 //	  defer func() { err = FromPanic(recover()) }()
 //	  // Foo body, may panic on error
 //	}
+//
+// When called outside of a panicking goroutine, e.g. with an error constructed
+// directly rather than obtained from recover(), there is no panic stack to
+// capture, and such an error is returned as is.
 func FromPanic(p any) error {
 	if p == nil {
 		return nil
 	}
-	if err, ok := p.(*annotatedError); ok {
-		pc := make([]uintptr, 20)
+	err, ok := matchPanic(p)
+	if !ok {
+		// Re-raise all other panics.
+		panic(p)
+	}
+	pc := make([]uintptr, 64)
+	for {
 		n := runtime.Callers(3, pc)
-		if n == 0 { // shouldn't happen, defensive code
-			return err
-		}
-		pc = pc[:n] // use only valid pcs
-		framesIter := runtime.CallersFrames(pc)
-
-		frames := []runtime.Frame{}
-		for {
-			frame, more := framesIter.Next()
-			frames = append(frames, frame)
-			if !more {
-				break
+		if n < len(pc) {
+			pc = pc[:n] // use only valid pcs
+			break
+		}
+		pc = make([]uintptr, 2*len(pc))
+	}
+	if len(pc) == 0 { // shouldn't happen, defensive code
+		return panicError(err, []Frame{})
+	}
+	framesIter := runtime.CallersFrames(pc)
+
+	frames := []runtime.Frame{}
+	for {
+		frame, more := framesIter.Next()
+		frames = append(frames, frame)
+		if !more {
+			break
+		}
+	}
+	if !inPanic(frames) {
+		return err
+	}
+	frames = trimFrames(frames)
+	if len(frames) == 0 { // no panic stack found, defensive code
+		return panicError(err, []Frame{})
+	}
+	stack := make([]Frame, len(frames))
+	// Invert the order of frames.
+	for i, f := range frames {
+		stack[len(frames)-1-i] = Frame{File: f.File, Line: f.Line, Function: f.Function}
+	}
+	return panicError(err, stack)
+}
+
+// panicError annotates the recovered error with the panic stack, and the build
+// information when CaptureBuildInfo is enabled.
+func panicError(err error, stack []Frame) error {
+	res := &annotatedError{orig: err, stack: stack}
+	if captureBuildInfo.get() {
+		return withValue(res, buildInfoKey{}, currentBuildInfo())
+	}
+	return res
+}
+
+var (
+	panicMatchersMu sync.RWMutex
+	panicMatchers   []func(any) (error, bool)
+)
+
+// RegisterPanicType registers a matcher of custom panic values to be recovered
+// by FromPanic as intentional panics, in addition to the errors of this
+// package. The matcher returns the error to recover and true, or false for the
+// values it does not recognize. Unrecognized panics, including runtime errors,
+// remain re-raised. It is intended to be called at program initialization:
+//
+//	errors.RegisterPanicType(func(p any) (error, bool) {
+//	  e, ok := p.(*MyException)
+//	  return e, ok
+//	})
+func RegisterPanicType(match func(any) (error, bool)) {
+	panicMatchersMu.Lock()
+	defer panicMatchersMu.Unlock()
+	panicMatchers = append(panicMatchers, match)
+}
+
+// matchPanic returns the error of an intentional panic value p.
+func matchPanic(p any) (error, bool) {
+	if err, ok := p.(*annotatedError); ok {
+		return err, true
+	}
+	panicMatchersMu.RLock()
+	defer panicMatchersMu.RUnlock()
+	for _, match := range panicMatchers {
+		if err, ok := match(p); ok && err != nil {
+			return err, true
+		}
+	}
+	return nil, false
+}
+
+// SafeCall runs fn and converts its intentional panics (see ReasonPanic) into
+// the returned error, in which case the returned value is the zero value of T.
+// Other panics are re-raised. This makes the panic-as-exception pattern usable
+// with generic functions and unnamed return values:
+//
+//	v, err := errors.SafeCall(func() (int, error) { return parse(s) })
+func SafeCall[T any](fn func() (T, error)) (res T, err error) {
+	defer func() {
+		if e := FromPanic(recover()); e != nil {
+			var zero T
+			res, err = zero, e
+		}
+	}()
+	return fn()
+}
+
+// Try returns (v, nil) if err is nil, and otherwise v together with err
+// annotated as by Annotate at the caller's location. It shortens returning a
+// value with an annotated error:
+//
+//	n, err := strconv.Atoi(s)
+//	return errors.Try(n, err, "cannot parse %q", s)
+func Try[T any](v T, err error, s string, args ...any) (T, error) {
+	if err == nil {
+		return v, nil
+	}
+	return v, dedup(err, annotate(err, 2, s, args...))
+}
+
+// GoWithContext runs fn in a new goroutine, converting its intentional panics
+// (see ReasonPanic) into an error, and annotating the resulting error with the
+// label and the location of the GoWithContext call. The returned channel
+// receives exactly one value, the error or nil, and is then closed. Other
+// panics are re-raised in the goroutine.
+//
+//	ch := errors.GoWithContext(fmt.Sprintf("worker %d", id), work)
+//	...
+//	if err := <-ch; err != nil { ... }
+func GoWithContext(label string, fn func() error) <-chan error {
+	pc, _, _, _ := runtime.Caller(1)
+	ch := make(chan error, 1)
+	go func() {
+		defer close(ch)
+		err := func() (err error) {
+			defer func() {
+				if e := FromPanic(recover()); e != nil {
+					err = e
+				}
+			}()
+			return fn()
+		}()
+		if err != nil {
+			e := annotatePC(err, pc, label)
+			e.literal = true
+			err = e
+		}
+		ch <- err
+	}()
+	return ch
+}
+
+// StackTrace returns the panic call stack captured by FromPanic nearest to the
+// top of err's chain, outermost call first, or nil if there is none.
+func StackTrace(err error) []Frame {
+	var stack []Frame
+	walk(err, func(e error) bool {
+		if a, ok := e.(*annotatedError); ok && a.stack != nil {
+			stack = a.stack
+			return true
+		}
+		return false
+	})
+	return stack
+}
+
+// Depth returns the number of errors in err's Unwrap() error chain, including
+// err itself and its root cause, e.g. 2 for Annotate(Reason(...)). Every layer
+// counts, including metadata such as WithTags. A multi-error counts as one
+// layer, without its branches. A nil *annotatedError counts as no error, as in
+// the other helpers. Returns 0 for a nil error.
+func Depth(err error) int {
+	n := 0
+	for err != nil {
+		if a, ok := err.(*annotatedError); ok && a == nil {
+			break
+		}
+		n++
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		err = u.Unwrap()
+	}
+	return n
+}
+
+// CallPath returns the functions of the annotation locations in err's chain,
+// outermost first, e.g. as a compact breadcrumb of how the error propagated.
+// Annotations with an unknown location are represented by "?". Panic stacks
+// are not included, see StackTrace.
+func CallPath(err error) []string {
+	var path []string
+	walk(err, func(e error) bool {
+		if a, ok := e.(*annotatedError); ok && a.stack == nil {
+			if a.frame.Function == "" {
+				path = append(path, "?")
+			} else {
+				path = append(path, a.frame.Function)
 			}
 		}
-		frames = trimFrames(frames)
-		// Invert frames in place.
-		for l, h := 0, len(frames)-1; l < h; l, h = l+1, h-1 {
-			frames[l], frames[h] = frames[h], frames[l]
+		return false
+	})
+	return path
+}
+
+// HasStack reports whether any layer of err's chain carries a non-empty panic
+// call stack captured by FromPanic, e.g. to include a stack field in a log
+// entry only when there is one.
+func HasStack(err error) bool {
+	return walk(err, func(e error) bool {
+		a, ok := e.(*annotatedError)
+		return ok && len(a.stack) > 0
+	})
+}
+
+// FromPanicOrigin reports whether any layer of err's chain was produced by
+// recovering a panic with FromPanic, as opposed to err being only returned and
+// annotated normally.
+func FromPanicOrigin(err error) bool {
+	return walk(err, func(e error) bool {
+		a, ok := e.(*annotatedError)
+		return ok && a.stack != nil
+	})
+}
+
+// walk visits err and the errors in its "Unwrap" chain in depth-first order,
+// following both Unwrap() error and Unwrap() []error. It stops and returns true
+// as soon as visit returns true. A nil *annotatedError ends its branch without
+// being visited. The secondary errors of AnnotateWith2 are not visited, so that
+// their metadata is not attributed to the primary error; they are matched only
+// by Is, As and the helpers using walkWithSecondary.
+func walk(err error, visit func(error) bool) bool {
+	for err != nil {
+		if a, ok := err.(*annotatedError); ok && a == nil {
+			return false
 		}
-		traces := make([]string, len(frames))
-		for i, frame := range frames {
-			traces[i] = fmt.Sprintf("PANIC: %s:%d: %s()",
-				frame.File, frame.Line, frame.Function)
+		if visit(err) {
+			return true
 		}
-		if len(traces) == 0 { // no panic stack found, defensive code
-			return err
+		switch u := err.(type) {
+		case interface{ Unwrap() error }:
+			err = u.Unwrap()
+		case interface{ Unwrap() []error }:
+			for _, e := range u.Unwrap() {
+				if walk(e, visit) {
+					return true
+				}
+			}
+			return false
+		default:
+			return false
 		}
-		return &annotatedError{orig: err, curr: strings.Join(traces, "\n")}
 	}
-	// Re-raise all other panics.
-	panic(p)
+	return false
+}
+
+// walkWithSecondary is the same as walk, but it also visits the secondary
+// errors of AnnotateWith2, each right after its annotation, in the same order as
+// Is and As. It is used for matching errors by identity or type, while the
+// metadata lookups remain on the primary chain.
+func walkWithSecondary(err error, visit func(error) bool) bool {
+	return walk(err, func(e error) bool {
+		if visit(e) {
+			return true
+		}
+		a, ok := e.(*annotatedError)
+		return ok && a.also != nil && walkWithSecondary(a.also, visit)
+	})
 }
 
 // Is reports whether any error in err's "Unwrap" chain matches target.
@@ -180,6 +879,27 @@ func Is(err, target error) bool {
 	return errors.Is(err, target)
 }
 
+// ShareCause reports whether the trees of the two errors have a common error,
+// i.e. some error in b's tree matches a according to Is. This is the case, for
+// instance, when both errors are annotations of the same original error, or
+// when one error annotates the other. Both Unwrap() error and Unwrap() []error
+// branches are followed, as well as the secondary errors of AnnotateWith2, as
+// in Is.
+func ShareCause(a, b error) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	return walkWithSecondary(b, func(e error) bool { return Is(a, e) })
+}
+
+// Match reports whether any error in err's tree satisfies the predicate. Both
+// Unwrap() error and Unwrap() []error branches are followed, as well as the
+// secondary errors of AnnotateWith2, as in Is and As. This is the general
+// escape hatch for matching logic not covered by Is and As.
+func Match(err error, pred func(error) bool) bool {
+	return walkWithSecondary(err, pred)
+}
+
 // As sets the target to the first applicable value in err's "Unwrap" chain.
 //
 // It is exactly as Go's errors.As method, and is provided to match the
@@ -187,3 +907,26 @@ func Is(err, target error) bool {
 func As(err error, target any) bool {
 	return errors.As(err, target)
 }
+
+// AsType finds the first error in err's "Unwrap" chain whose concrete type is
+// T or *T, and returns a pointer to it. Like As, it also finds the secondary
+// errors of AnnotateWith2. Unlike As, it does not use reflection, and works for
+// error types with either value or pointer receivers:
+//
+//	if e, ok := errors.AsType[*fs.PathError](err); ok { ... } // e is **fs.PathError
+//	if e, ok := errors.AsType[fs.PathError](err); ok { ... }  // e is *fs.PathError
+func AsType[T any](err error) (*T, bool) {
+	var res *T
+	found := walkWithSecondary(err, func(e error) bool {
+		switch v := any(e).(type) {
+		case T:
+			res = &v
+			return true
+		case *T:
+			res = v
+			return true
+		}
+		return false
+	})
+	return res, found
+}
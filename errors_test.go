@@ -59,6 +59,48 @@ func fnC(mode string) {
 	}
 }
 
+// curLine returns the line number of its caller.
+func curLine() int {
+	_, _, line, _ := runtime.Caller(1)
+	return line
+}
+
+// multiError is a minimal error with multiple branches.
+type multiError struct{ errs []error }
+
+func (e *multiError) Error() string   { return "multi" }
+func (e *multiError) Unwrap() []error { return e.errs }
+
+type ptrError struct{ msg string }
+
+func (e *ptrError) Error() string { return e.msg }
+
+// wrapError is a foreign error with a single branch.
+type wrapError struct{ orig error }
+
+func (e *wrapError) Error() string { return "wrap: " + e.orig.Error() }
+func (e *wrapError) Unwrap() error { return e.orig }
+
+// recurse panics with an error from n levels of recursion.
+func recurse(n int) {
+	if n == 0 {
+		ReasonPanic("deep")
+	}
+	recurse(n - 1)
+}
+
+// failf is a decorator reporting its caller's location with ReasonPC.
+func failf(s string, args ...any) error {
+	var pcs [1]uintptr
+	runtime.Callers(2, pcs[:])
+	return ReasonPC(pcs[0]-1, s, args...)
+}
+
+// wrapErr is a helper to be registered with MarkWrapper.
+func wrapErr(s string) error {
+	return Reason("wrapped: " + s)
+}
+
 func TestErrors(t *testing.T) {
 	Convey("Reason works", t, func() {
 		e := rsn("because")
@@ -66,6 +108,13 @@ func TestErrors(t *testing.T) {
 			"errors_test.go:26: github.com/stockparfait/errors.rsn() because")
 	})
 
+	Convey("String is the same as Error", t, func() {
+		e := ann(rsn("because"), "failed")
+		s, ok := e.(interface{ String() string })
+		So(ok, ShouldBeTrue)
+		So(s.String(), ShouldEqual, e.Error())
+	})
+
 	Convey("Annotate works", t, func() {
 		Convey("annotates non-nil error", func() {
 			e := ann(rsn("because"), "failed %s", "me")
@@ -75,6 +124,26 @@ func TestErrors(t *testing.T) {
 				"errors_test.go:26: github.com/stockparfait/errors.rsn() because")
 		})
 
+		Convey("keeps the template and arguments", func() {
+			e := ann(myError("mine"), "failed %s %d", "me", 2).(*annotatedError)
+			So(e.format, ShouldEqual, "failed %s %d")
+			So(e.args, ShouldResemble, []any{"me", 2})
+			So(e.message(), ShouldEqual, "failed me 2")
+		})
+
+		Convey("formats only when needed", func() {
+			So(ann(myError("mine"), "100%%").Error(), ShouldContainSubstring, "ann() 100%\n")
+			So(ann(myError("mine"), "plain").Error(), ShouldContainSubstring, "ann() plain\n")
+		})
+
+		Convey("adds location only for an empty message", func() {
+			for _, msg := range []string{"", "  \t"} {
+				e := ann(rsn("because"), msg)
+				So(e.Error(), ShouldContainSubstring,
+					"errors_test.go:31: github.com/stockparfait/errors.ann()\n")
+			}
+		})
+
 		Convey("passes through nil error", func() {
 			So(ann(nil, "you won't see this"), ShouldBeNil)
 		})
@@ -87,6 +156,460 @@ func TestErrors(t *testing.T) {
 			So(As(annotated, &err2), ShouldBeTrue)
 			So(err2, ShouldEqual, err)
 		})
+
+		Convey("ShareCause works", func() {
+			root := rsn("because")
+			a := ann(root, "a")
+			b := WithSampleKey(ann(root, "b"), "key")
+			So(ShareCause(a, b), ShouldBeTrue)
+			So(ShareCause(b, a), ShouldBeTrue)
+			So(ShareCause(ann(a, "outer"), a), ShouldBeTrue)
+			So(ShareCause(a, ann(rsn("because"), "b")), ShouldBeFalse)
+			So(ShareCause(nil, a), ShouldBeFalse)
+			So(ShareCause(a, nil), ShouldBeFalse)
+
+			Convey("with multi-error branches", func() {
+				m := &multiError{errs: []error{myError("x"), ann(root, "c")}}
+				So(ShareCause(a, m), ShouldBeTrue)
+				So(ShareCause(m, a), ShouldBeTrue)
+				So(ShareCause(m, ann(myError("x"), "d")), ShouldBeTrue)
+				So(ShareCause(m, myError("y")), ShouldBeFalse)
+			})
+		})
+
+		Convey("Match works", func() {
+			long := func(e error) bool {
+				p, ok := e.(*ptrError)
+				return ok && len(p.msg) > 3
+			}
+			So(Match(ann(&ptrError{msg: "long"}, "annotated"), long), ShouldBeTrue)
+			So(Match(ann(&ptrError{msg: "no"}, "annotated"), long), ShouldBeFalse)
+			So(Match(nil, long), ShouldBeFalse)
+			m := &multiError{errs: []error{myError("x"), ann(&ptrError{msg: "long"}, "c")}}
+			So(Match(ann(m, "annotated"), long), ShouldBeTrue)
+		})
+
+		Convey("helpers traverse mixed trees", func() {
+			leaf1 := &ptrError{msg: "leaf1"}
+			leaf2 := myError("leaf2")
+			rollback := WithEndpoint(fnA("error"), "cache")
+			// Both Unwrap forms at several levels, foreign and own errors, and a
+			// secondary error which is not traversed.
+			tree := ann(&multiError{errs: []error{
+				&wrapError{orig: WithTags(&multiError{errs: []error{
+					AnnotateWithFields(leaf1, map[string]any{"a": 1}, "l1"),
+					&wrapError{orig: WithOperation(leaf2, "Op")},
+				}}, "t1")},
+				AnnotateWith2(WithEndpoint(rsn("primary"), "db"), rollback, "failed"),
+			}}, "outer")
+
+			var visited []string
+			Match(tree, func(e error) bool {
+				switch e.(type) {
+				case *annotatedError:
+					visited = append(visited, "A")
+				case *valueError:
+					visited = append(visited, "V")
+				case *multiError:
+					visited = append(visited, "M")
+				case *wrapError:
+					visited = append(visited, "W")
+				default:
+					visited = append(visited, e.Error())
+				}
+				return false
+			})
+			So(visited, ShouldResemble, []string{
+				"A", "M", "W", "V", "M", "A", "leaf1", "W", "V", "leaf2",
+				"A", "V", "A", "A", "V", "A",
+			})
+
+			So(Is(tree, leaf1), ShouldBeTrue)
+			So(Is(tree, leaf2), ShouldBeTrue)
+			So(Is(tree, rollback), ShouldBeTrue)
+			e, ok := AsType[*ptrError](tree)
+			So(ok, ShouldBeTrue)
+			So(*e, ShouldEqual, leaf1)
+			So(Fields(tree), ShouldResemble, map[string]any{"a": 1})
+			So(Tags(tree), ShouldResemble, []string{"t1"})
+			op, ok := Operation(tree)
+			So(ok, ShouldBeTrue)
+			So(op, ShouldEqual, "Op")
+			So(ShareCause(leaf2, tree), ShouldBeTrue)
+
+			Convey("matching the secondary error as Is and As do", func() {
+				sec := myError("sec")
+				x := ann(AnnotateWith2(rsn("p"), ann(sec, "rollback"), "x"), "y")
+				So(Is(x, sec), ShouldBeTrue)
+				So(Match(x, func(e error) bool { return e == sec }), ShouldBeTrue)
+				So(ShareCause(x, sec), ShouldBeTrue)
+				So(ShareCause(sec, x), ShouldBeTrue)
+				var target myError
+				So(As(x, &target), ShouldBeTrue)
+				r, ok := AsType[myError](x)
+				So(ok, ShouldBeTrue)
+				So(*r, ShouldEqual, sec)
+			})
+
+			Convey("without the secondary error's metadata", func() {
+				endpoint, ok := Endpoint(tree)
+				So(ok, ShouldBeTrue)
+				So(endpoint, ShouldEqual, "db")
+				So(HasStack(tree), ShouldBeFalse)
+				So(FromPanicOrigin(tree), ShouldBeFalse)
+				So(StackTrace(tree), ShouldBeNil)
+				So(len(CallPath(tree)), ShouldEqual, 4)
+			})
+		})
+
+		Convey("AsType works", func() {
+			Convey("with a value receiver", func() {
+				err := myError("mine")
+				e, ok := AsType[myError](ann(err, "annotated"))
+				So(ok, ShouldBeTrue)
+				So(*e, ShouldEqual, err)
+			})
+
+			Convey("with a pointer receiver", func() {
+				err := &ptrError{msg: "mine"}
+				e, ok := AsType[ptrError](ann(err, "annotated"))
+				So(ok, ShouldBeTrue)
+				So(e, ShouldEqual, err)
+
+				e2, ok := AsType[*ptrError](ann(err, "annotated"))
+				So(ok, ShouldBeTrue)
+				So(*e2, ShouldEqual, err)
+			})
+
+			Convey("when not found", func() {
+				e, ok := AsType[ptrError](ann(myError("mine"), "annotated"))
+				So(ok, ShouldBeFalse)
+				So(e, ShouldBeNil)
+				_, ok = AsType[myError](nil)
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Allocation budget is respected", t, func() {
+		err := myError("mine")
+		So(testing.AllocsPerRun(100, func() { _ = Reason("because") }),
+			ShouldBeLessThanOrEqualTo, 3)
+		So(testing.AllocsPerRun(100, func() { _ = Annotate(err, "failed %s", "me") }),
+			ShouldBeLessThanOrEqualTo, 4)
+	})
+
+	Convey("Invalid stack levels are reported", t, func() {
+		So(ReasonStack(-1, "because").Error(), ShouldEqual,
+			"ERROR: ???(stack=-1): because")
+		So(ReasonStack(1000000, "because").Error(), ShouldEqual,
+			"ERROR: ???(stack=1000000): because")
+		So(AnnotateStack(myError("mine"), -2, "failed").Error(), ShouldEqual,
+			"ERROR: ???(stack=-2): failed\nmine")
+	})
+
+	Convey("Const works", t, func() {
+		errFoo := Const("foo")
+
+		Convey("is comparable", func() {
+			So(errFoo == Const("foo"), ShouldBeTrue)
+			So(errFoo == Const("bar"), ShouldBeFalse)
+			So(errFoo.Error(), ShouldEqual, "foo")
+		})
+
+		Convey("works in a switch", func() {
+			res := ""
+			switch Const("foo") {
+			case Const("bar"):
+				res = "bar"
+			case errFoo:
+				res = "foo"
+			}
+			So(res, ShouldEqual, "foo")
+		})
+
+		Convey("can be annotated", func() {
+			e := ann(errFoo, "annotated")
+			So(e.Error(), ShouldContainSubstring,
+				"errors_test.go:31: github.com/stockparfait/errors.ann() annotated\nfoo")
+			So(Is(e, Const("foo")), ShouldBeTrue)
+		})
+	})
+
+	Convey("AnnotateOnce works", t, func() {
+		mw := func(err error) error {
+			return AnnotateOnce(err, "mw", "middleware %d", 1)
+		}
+		So(mw(nil), ShouldBeNil)
+		err := mw(rsn("because"))
+		So(err.Error(), ShouldContainSubstring, "() middleware 1\n")
+		So(mw(err), ShouldEqual, err)
+		So(mw(ann(err, "annotated")).Error(), ShouldEqual, ann(err, "annotated").Error())
+		So(AnnotateOnce(err, "other", "other"), ShouldNotEqual, err)
+	})
+
+	Convey("AnnotateAt works", t, func() {
+		pc, line := Here(), curLine()
+		handle := func(err error) error {
+			return AnnotateAt(err, pc, "handled %d", 1)
+		}
+		err := handle(rsn("because"))
+		So(err.Error(), ShouldContainSubstring, "errors_test.go:")
+		So(err.Error(), ShouldContainSubstring, "TestErrors.func")
+		So(err.Error(), ShouldContainSubstring, "() handled 1\n")
+		So(err.(*annotatedError).frame.Line, ShouldEqual, line)
+		So(handle(nil), ShouldBeNil)
+		So(AnnotateAt(myError("mine"), 0, "unknown").Error(), ShouldEqual,
+			"ERROR: ???: unknown\nmine")
+	})
+
+	Convey("LazyReason works", t, func() {
+		calls := 0
+		line := curLine() + 1
+		err := LazyReason(func() string { calls++; return "lazy 100%" })
+		So(calls, ShouldEqual, 0)
+		So(err.(*annotatedError).frame.Line, ShouldEqual, line)
+		So(Is(ann(err, "annotated"), err), ShouldBeTrue)
+		So(calls, ShouldEqual, 0)
+
+		So(err.Error(), ShouldEndWith, "() lazy 100%")
+		So(ann(err, "annotated").Error(), ShouldEndWith, "() lazy 100%")
+		So(calls, ShouldEqual, 1)
+		So(Redact(err).Error(), ShouldEqual, err.Error())
+		So(calls, ShouldEqual, 1)
+	})
+
+	Convey("ReasonPC works", t, func() {
+		line := curLine() + 1
+		err := failf("failed %d", 1).(*annotatedError)
+		So(err.frame.Line, ShouldEqual, line)
+		So(err.frame.Function, ShouldStartWith, "github.com/stockparfait/errors.TestErrors")
+		So(err.message(), ShouldEqual, "failed 1")
+		So(ReasonPC(0, "unknown").Error(), ShouldEqual, "ERROR: ???: unknown")
+	})
+
+	Convey("MarkWrapper works", t, func() {
+		defer func() { wrappers = nil }()
+
+		So(wrapErr("x").Error(), ShouldContainSubstring, "errors.wrapErr() wrapped: x")
+		MarkWrapper("github.com/stockparfait/errors.wrapErr")
+		line := curLine() + 1
+		err := wrapErr("x").(*annotatedError)
+		So(err.frame.Line, ShouldEqual, line)
+		So(err.frame.Function, ShouldStartWith, "github.com/stockparfait/errors.TestErrors")
+		So(err.message(), ShouldEqual, "wrapped: x")
+	})
+
+	Convey("Require works", t, func() {
+		Convey("annotates a non-nil error", func() {
+			err := Require(rsn("because"), "required %d", 1)
+			So(err.Error(), ShouldContainSubstring, "errors_test.go:")
+			So(err.Error(), ShouldContainSubstring, "TestErrors")
+			So(err.Error(), ShouldContainSubstring, "() required 1\n")
+		})
+
+		Convey("panics on nil", func() {
+			err := func() (err error) {
+				defer func() { err = FromPanic(recover()) }()
+				return Require(nil, "required %d", 1)
+			}()
+			So(err.Error(), ShouldContainSubstring, "unexpected nil error: required 1")
+		})
+	})
+
+	Convey("nil *annotatedError is safe", t, func() {
+		var nilErr *annotatedError
+		var err error = nilErr
+		So(err != nil, ShouldBeTrue)
+		So(err.Error(), ShouldEqual, "")
+		So(nilErr.String(), ShouldEqual, "")
+		So(nilErr.Unwrap(), ShouldBeNil)
+		So(Is(err, myError("mine")), ShouldBeFalse)
+		So(Is(err, err), ShouldBeTrue)
+		var target myError
+		So(As(err, &target), ShouldBeFalse)
+		So(ann(err, "annotated").Error(), ShouldEndWith, "errors.ann() annotated")
+		So(DefaultRenderer.RenderError(err), ShouldEqual, "")
+
+		Convey("in the helpers", func() {
+			So(Fields(err), ShouldBeNil)
+			So(HasStack(err), ShouldBeFalse)
+			So(FromPanicOrigin(err), ShouldBeFalse)
+			So(StackTrace(err), ShouldBeNil)
+			So(CallPath(err), ShouldBeNil)
+			So(Fingerprint(err), ShouldNotEqual, "")
+			So(Attributes(err)["error.message"], ShouldEqual, "")
+			host, pid := Origin(err)
+			So(host, ShouldEqual, "")
+			So(pid, ShouldEqual, 0)
+			So(AnnotateOnce(err, "k", "once").Error(), ShouldEndWith, " once")
+			So(Info(err), ShouldResemble, ErrorInfo{})
+			So(Brief(err), ShouldEqual, "")
+			So(Plainify(err).Error(), ShouldEqual, "")
+			So(Plainify(ann(err, "annotated")).Error(), ShouldEqual, "annotated")
+			So(Redact(err), ShouldEqual, err)
+			So(RemoveLayers(err, func(error) bool { return true }), ShouldEqual, err)
+			So(TreeString(err), ShouldEqual, "")
+		})
+	})
+
+	Convey("Quiet works", t, func() {
+		errDone := Quiet("done")
+		So(errDone.Error(), ShouldEqual, "done")
+		So(errDone == Quiet("done"), ShouldBeTrue)
+		So(errDone == Const("done"), ShouldBeFalse)
+		err := ann(errDone, "annotated")
+		So(IsQuiet(err), ShouldBeTrue)
+		So(Is(err, errDone), ShouldBeTrue)
+		So(IsQuiet(nil), ShouldBeFalse)
+		So(IsQuiet(ann(Const("done"), "annotated")), ShouldBeFalse)
+	})
+
+	Convey("AnnotateAll works", t, func() {
+		So(AnnotateAll(nil, "a", "b"), ShouldBeNil)
+		root := myError("root")
+		So(AnnotateAll(root), ShouldEqual, root)
+
+		line := curLine() + 1
+		err := AnnotateAll(root, "step 100%", "operation", "module")
+		So(Plainify(err).Error(), ShouldEqual, "module: operation: step 100%: root")
+		So(Is(err, root), ShouldBeTrue)
+		for e := err; e != root; e = e.(*annotatedError).orig {
+			So(e.(*annotatedError).frame.Line, ShouldEqual, line)
+		}
+		So(Summary(err), ShouldEqual, "module")
+		So(SameTemplate(AnnotateAll(root, "module A"), AnnotateAll(root, "module B")), ShouldBeFalse)
+	})
+
+	Convey("Try works", t, func() {
+		v, err := Try(42, nil, "never")
+		So(v, ShouldEqual, 42)
+		So(err, ShouldBeNil)
+
+		root := myError("root")
+		line := curLine() + 1
+		s, err := Try("partial", root, "failed %d", 1)
+		So(s, ShouldEqual, "partial")
+		So(Is(err, root), ShouldBeTrue)
+		So(err.(*annotatedError).frame.Line, ShouldEqual, line)
+		So(err.(*annotatedError).frame.Function, ShouldStartWith,
+			"github.com/stockparfait/errors.TestErrors")
+		So(err.(*annotatedError).message(), ShouldEqual, "failed 1")
+	})
+
+	Convey("Assert works", t, func() {
+		So(Assert(true, "never"), ShouldBeNil)
+		line := curLine() + 1
+		err := Assert(1 > 2, "x must be positive, got %d", -1)
+		So(err.Error(), ShouldContainSubstring, "() x must be positive, got -1")
+		So(err.(*annotatedError).frame.Line, ShouldEqual, line)
+		So(err.(*annotatedError).frame.Function, ShouldStartWith,
+			"github.com/stockparfait/errors.TestErrors")
+	})
+
+	Convey("Invariant works", t, func() {
+		var line int
+		check := func(cond bool) (err error) {
+			defer func() { err = FromPanic(recover()) }()
+			line = curLine() + 1
+			Invariant(cond, "broken %d", 1)
+			return nil
+		}
+		So(check(true), ShouldBeNil)
+		err := check(false)
+		So(err, ShouldNotBeNil)
+		So(HasStack(err), ShouldBeTrue)
+		e := err.(*annotatedError).orig.(*annotatedError)
+		So(e.frame.Line, ShouldEqual, line)
+		So(e.message(), ShouldEqual, "broken 1")
+	})
+
+	Convey("FirstError works", t, func() {
+		So(FirstError(), ShouldBeNil)
+		So(FirstError(nil, nil), ShouldBeNil)
+
+		second := myError("second")
+		err := FirstError(nil, second, myError("third"))
+		So(Is(err, second), ShouldBeTrue)
+		So(err.Error(), ShouldContainSubstring, "errors_test.go:")
+		So(err.Error(), ShouldContainSubstring, "TestErrors")
+		So(err.Error(), ShouldEndWith, "() error at index 1\nsecond")
+	})
+
+	Convey("AnnotateDeferred works", t, func() {
+		primary := myError("primary")
+		deferred := &ptrError{msg: "deferred"}
+		run := func(p, d error) (err error) {
+			defer AnnotateDeferred(&err, func() error { return d }, "cleanup 100%")
+			return p
+		}
+
+		Convey("keeps the primary error when cleanup succeeds", func() {
+			So(run(primary, nil), ShouldEqual, primary)
+			So(run(nil, nil), ShouldBeNil)
+		})
+
+		Convey("annotates the deferred error without a primary", func() {
+			err := run(nil, deferred)
+			So(err.Error(), ShouldContainSubstring, "errors_test.go:")
+			So(err.Error(), ShouldContainSubstring, "TestErrors")
+			So(err.Error(), ShouldEndWith, "() cleanup 100%\ndeferred")
+			So(Is(err, deferred), ShouldBeTrue)
+		})
+
+		Convey("keeps both errors", func() {
+			err := run(primary, deferred)
+			So(err.Error(), ShouldEndWith, "() cleanup 100%\nprimary\n(also: deferred)")
+			So(Is(err, primary), ShouldBeTrue)
+			So(Is(err, deferred), ShouldBeTrue)
+			So(Is(err, myError("other")), ShouldBeFalse)
+			var e1 myError
+			So(As(err, &e1), ShouldBeTrue)
+			So(e1, ShouldEqual, primary)
+			var e2 *ptrError
+			So(As(err, &e2), ShouldBeTrue)
+			So(e2, ShouldEqual, deferred)
+			So(Plainify(err).Error(), ShouldEqual, "cleanup 100%: primary (also: deferred)")
+			So(Redact(err).Error(), ShouldEqual, err.Error())
+			So(Summary(err), ShouldEqual, "cleanup 100%")
+		})
+	})
+
+	Convey("AnnotateWith2 works", t, func() {
+		primary := rsn("primary")
+		rollback := ann(myError("rollback"), "cannot roll back")
+
+		Convey("keeps both errors", func() {
+			line := curLine() + 1
+			err := AnnotateWith2(ann(primary, "annotated"), rollback, "failed %d", 1)
+			So(err.(*annotatedError).frame.Line, ShouldEqual, line)
+			So(Is(err, primary), ShouldBeTrue)
+			So(Is(err, myError("rollback")), ShouldBeTrue)
+			var target myError
+			So(As(err, &target), ShouldBeTrue)
+			So(target, ShouldEqual, myError("rollback"))
+
+			msg := ann(err, "outer").Error()
+			So(msg, ShouldContainSubstring, "errors.ann() outer\nERROR: ")
+			So(msg, ShouldContainSubstring, "() failed 1\nERROR: ")
+			So(msg, ShouldContainSubstring, "errors.ann() annotated\nERROR: ")
+			So(msg, ShouldContainSubstring, "errors.rsn() primary\n(also: ERROR: ")
+			So(msg, ShouldEndWith, "errors.ann() cannot roll back\nrollback)")
+			So(Plainify(err).Error(), ShouldEqual,
+				"failed 1: annotated: primary (also: cannot roll back: rollback)")
+		})
+
+		Convey("nil secondary is the same as Annotate", func() {
+			err := AnnotateWith2(primary, nil, "failed")
+			So(err.Error(), ShouldContainSubstring, "errors_test.go:")
+			So(err.Error(), ShouldContainSubstring, "TestErrors")
+			So(err.(*annotatedError).also, ShouldBeNil)
+		})
+
+		Convey("nil primary", func() {
+			So(AnnotateWith2(nil, rollback, "failed"), ShouldBeNil)
+			So(AnnotateWith2(nil, nil, "failed"), ShouldBeNil)
+		})
 	})
 
 	Convey("Panic methods work", t, func() {
@@ -122,6 +645,173 @@ func TestErrors(t *testing.T) {
 				"errors_test.go:51: github.com/stockparfait/errors.fnC()")
 		})
 
+		Convey("SafeCall", func() {
+			Convey("returns normally", func() {
+				v, err := SafeCall(func() (int, error) { return 42, nil })
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, 42)
+
+				v, err = SafeCall(func() (int, error) { return 1, myError("mine") })
+				So(err, ShouldEqual, myError("mine"))
+				So(v, ShouldEqual, 1)
+			})
+
+			Convey("recovers an error panic", func() {
+				v, err := SafeCall(func() (string, error) {
+					ReasonPanic("failed %d", 1)
+					return "value", nil
+				})
+				So(v, ShouldEqual, "")
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "() failed 1")
+				So(StackTrace(err), ShouldNotBeNil)
+			})
+
+			Convey("re-raises other panics", func() {
+				So(func() {
+					_, _ = SafeCall(func() (int, error) { panic("boom") })
+				}, ShouldPanic)
+			})
+		})
+
+		Convey("GoWithContext", func() {
+			Convey("success", func() {
+				ch := GoWithContext("worker 1", func() error { return nil })
+				So(<-ch, ShouldBeNil)
+				_, ok := <-ch
+				So(ok, ShouldBeFalse)
+			})
+
+			Convey("returned error", func() {
+				err := <-GoWithContext("worker 2", func() error { return myError("mine") })
+				So(err.Error(), ShouldContainSubstring, "errors_test.go:")
+				So(err.Error(), ShouldContainSubstring, "() worker 2\nmine")
+				So(Summary(err), ShouldEqual, "worker 2")
+			})
+
+			Convey("recovered panic", func() {
+				err := <-GoWithContext("worker 3", func() error {
+					ReasonPanic("failed %d", 3)
+					return nil
+				})
+				So(err.Error(), ShouldContainSubstring, "() worker 3\nPANIC: ")
+				So(err.Error(), ShouldContainSubstring, "() failed 3")
+				So(StackTrace(err), ShouldNotBeNil)
+			})
+		})
+
+		Convey("StackTrace", func() {
+			So(StackTrace(rsn("because")), ShouldBeNil)
+			stack := StackTrace(ann(fnA("error"), "annotated"))
+			So(len(stack), ShouldBeGreaterThan, 3)
+			So(stack[len(stack)-1].Function, ShouldEqual, "github.com/stockparfait/errors.ReasonPanic")
+			So(stack[len(stack)-2].Function, ShouldEqual, "github.com/stockparfait/errors.fnC")
+		})
+
+		Convey("StackTrace of a deep panic", func() {
+			err := func() (err error) {
+				defer func() { err = FromPanic(recover()) }()
+				recurse(100)
+				return nil
+			}()
+			stack := StackTrace(err)
+			n := 0
+			for _, f := range stack {
+				if f.Function == "github.com/stockparfait/errors.recurse" {
+					n++
+				}
+			}
+			So(n, ShouldEqual, 101)
+			So(stack[len(stack)-1].Function, ShouldEqual, "github.com/stockparfait/errors.ReasonPanic")
+			entry := false
+			for _, f := range stack[:3] {
+				if f.Function == "testing.tRunner" {
+					entry = true
+				}
+			}
+			So(entry, ShouldBeTrue)
+		})
+
+		Convey("FromPanicFull", func() {
+			err := func() (err error) {
+				defer func() { err = FromPanicFull(recover()) }()
+				fnC("error")
+				return nil
+			}()
+			So(err.Error(), ShouldContainSubstring, "PANIC: ")
+			So(err.Error(), ShouldNotContainSubstring, "goroutine ")
+			dump, ok := GoroutineDump(ann(err, "annotated"))
+			So(ok, ShouldBeTrue)
+			So(dump, ShouldStartWith, "goroutine ")
+			So(dump, ShouldContainSubstring, "errors.fnC")
+
+			So(FromPanicFull(nil), ShouldBeNil)
+			_, ok = GoroutineDump(FromPanicFull(rsn("because")))
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("FromPanicOrigin", func() {
+			So(FromPanicOrigin(nil), ShouldBeFalse)
+			So(FromPanicOrigin(ann(rsn("because"), "annotated")), ShouldBeFalse)
+			So(FromPanicOrigin(ann(fnA("error"), "annotated")), ShouldBeTrue)
+			So(FromPanicOrigin(&annotatedError{orig: myError("root"), stack: []Frame{}}), ShouldBeTrue)
+		})
+
+		Convey("Depth", func() {
+			So(Depth(nil), ShouldEqual, 0)
+			So(Depth(myError("mine")), ShouldEqual, 1)
+			So(Depth(ann(rsn("because"), "annotated")), ShouldEqual, 2)
+			So(Depth(ann(WithTags(&multiError{errs: []error{rsn("a")}}, "t"), "x")), ShouldEqual, 3)
+			var nilErr *annotatedError
+			So(Depth(nilErr), ShouldEqual, 0)
+			So(Depth(ann(nilErr, "annotated")), ShouldEqual, 1)
+		})
+
+		Convey("CallPath", func() {
+			So(CallPath(nil), ShouldBeNil)
+			So(CallPath(myError("mine")), ShouldBeNil)
+			err := ann(AnnotateAt(ann(fnA("error"), "annotated"), 0, "unknown"), "outer")
+			So(CallPath(err), ShouldResemble, []string{
+				"github.com/stockparfait/errors.ann",
+				"?",
+				"github.com/stockparfait/errors.ann",
+				"github.com/stockparfait/errors.fnC",
+			})
+		})
+
+		Convey("HasStack", func() {
+			So(HasStack(nil), ShouldBeFalse)
+			So(HasStack(rsn("because")), ShouldBeFalse)
+			So(HasStack(ann(fnA("error"), "annotated")), ShouldBeTrue)
+			So(HasStack(&annotatedError{orig: myError("root"), stack: []Frame{}}), ShouldBeFalse)
+		})
+
+		Convey("outside of a panic", func() {
+			err := rsn("because")
+			So(func() { So(FromPanic(err), ShouldEqual, err) }, ShouldNotPanic)
+			So(HasStack(FromPanic(err)), ShouldBeFalse)
+		})
+
+		Convey("RegisterPanicType", func() {
+			defer func() { panicMatchers = nil }()
+			custom := func(p any) (err error) {
+				defer func() { err = FromPanic(recover()) }()
+				panic(p)
+			}
+			So(func() { custom(myError("mine")) }, ShouldPanic)
+
+			RegisterPanicType(func(p any) (error, bool) {
+				e, ok := p.(myError)
+				return e, ok
+			})
+			err := custom(myError("mine"))
+			So(Is(err, myError("mine")), ShouldBeTrue)
+			So(HasStack(err), ShouldBeTrue)
+			So(err.Error(), ShouldStartWith, "PANIC: ")
+			So(err.Error(), ShouldEndWith, "\nmine")
+			So(func() { custom("other") }, ShouldPanic)
+		})
+
 		Convey("re-raise non-error panic", func() {
 			So(func() { fnA("panic") }, ShouldPanic)
 		})
@@ -150,3 +840,59 @@ func TestErrors(t *testing.T) {
 		})
 	})
 }
+
+func BenchmarkAs(b *testing.B) {
+	err := ann(ann(myError("mine"), "inner"), "outer")
+	for i := 0; i < b.N; i++ {
+		var e myError
+		As(err, &e)
+	}
+}
+
+func BenchmarkAsType(b *testing.B) {
+	err := ann(ann(myError("mine"), "inner"), "outer")
+	for i := 0; i < b.N; i++ {
+		AsType[myError](err)
+	}
+}
+
+func BenchmarkReason(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = Reason("because")
+	}
+}
+
+func BenchmarkReasonArgs(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = Reason("because of %d", i)
+	}
+}
+
+func BenchmarkAnnotate(b *testing.B) {
+	b.ReportAllocs()
+	err := myError("mine")
+	for i := 0; i < b.N; i++ {
+		_ = Annotate(err, "failed %s", "me")
+	}
+}
+
+func BenchmarkError(b *testing.B) {
+	b.ReportAllocs()
+	err := rsn("because")
+	for i := 0; i < 20; i++ {
+		err = ann(err, "level %d", i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = err.Error()
+	}
+}
+
+func BenchmarkFromPanic(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = fnA("error")
+	}
+}
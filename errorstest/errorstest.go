@@ -0,0 +1,72 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package errorstest provides helpers for testing code which uses the
+// github.com/stockparfait/errors package.
+package errorstest
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stockparfait/errors"
+)
+
+// locationRe matches the prefix and location of an annotation or a panic
+// stack line in any of the supported location styles, with an optional
+// revision (see errors.IncludeRevision). The prefix is required, so that other
+// text resembling a location, e.g. "localhost:8080:", is left intact, but it
+// may appear anywhere in a line, e.g. in an "(also: ...)" note or after the
+// message of a foreign wrapper.
+var locationRe = regexp.MustCompile(
+	`(?:ERROR|PANIC): (?:\S+:\d+(?:@\w+)?: \S+\(\)|\?\?\?(?:\(stack=-?\d+\))?:|\S+:\d+(?:@\w+)?:)`)
+
+// Normalize renders err as by its Error() method with the line prefixes and
+// source locations replaced by a stable "<loc>" placeholder, for use in golden
+// tests, e.g. "<loc> because". Assumes the default renderer. Returns "" for a
+// nil error.
+func Normalize(err error) string {
+	if err == nil {
+		return ""
+	}
+	lines := strings.Split(err.Error(), "\n")
+	for i, l := range lines {
+		lines[i] = locationRe.ReplaceAllLiteralString(l, "<loc>")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Must returns v if err is nil, and otherwise fails the test immediately,
+// reporting the full rendered error chain with its locations. It is intended
+// for test setup with functions returning (T, error):
+//
+//	f := errorstest.Must(t, os.Open(name))
+func Must[T any](t testing.TB, v T, err error) T {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error:\n%s", err.Error())
+	}
+	return v
+}
+
+// AssertDepth fails the test immediately if errors.Depth(err) is not n,
+// reporting the full rendered error chain. It is intended to catch accidental
+// double wrapping or missing annotations.
+func AssertDepth(t testing.TB, err error, n int) {
+	t.Helper()
+	if d := errors.Depth(err); d != n {
+		t.Fatalf("expected error depth %d, got %d:\n%v", n, d, err)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errorstest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stockparfait/errors"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeTB records fatal failures instead of stopping the test.
+type fakeTB struct {
+	testing.TB
+	fatal string
+}
+
+func (t *fakeTB) Helper() {}
+
+func (t *fakeTB) Fatalf(format string, args ...any) {
+	t.fatal = fmt.Sprintf(format, args...)
+}
+
+func TestErrorsTest(t *testing.T) {
+	t.Parallel()
+
+	Convey("Normalize works", t, func() {
+		Convey("for nil error", func() {
+			So(Normalize(nil), ShouldEqual, "")
+		})
+
+		Convey("for a single annotation", func() {
+			So(Normalize(errors.Reason("because")), ShouldEqual, "<loc> because")
+		})
+
+		Convey("for a chain", func() {
+			err := errors.Annotate(errors.Reason("because %d", 42), "failed: a.go:1: x")
+			So(Normalize(err), ShouldEqual, "<loc> failed: a.go:1: x\n<loc> because 42")
+		})
+
+		Convey("for an unknown location", func() {
+			So(Normalize(errors.ReasonStack(100, "deep")), ShouldEqual,
+				"<loc> deep")
+			So(Normalize(errors.ReasonStack(-1, "negative")), ShouldEqual,
+				"<loc> negative")
+		})
+
+		Convey("with a revision", func() {
+			So(Normalize(errors.Const("ERROR: file.go:26@0123456: pkg.F() because")),
+				ShouldEqual, "<loc> because")
+			So(Normalize(errors.Const("ERROR: pkg.F:26@0123456: because")),
+				ShouldEqual, "<loc> because")
+		})
+
+		Convey("for a panic", func() {
+			err := func() (err error) {
+				defer func() { err = errors.FromPanic(recover()) }()
+				errors.ReasonPanic("oops")
+				return nil
+			}()
+			So(err, ShouldNotBeNil)
+			for _, l := range strings.Split(Normalize(err), "\n") {
+				So(l, ShouldStartWith, "<loc>")
+			}
+		})
+
+		Convey("for non-annotated errors", func() {
+			So(Normalize(errors.Const("plain")), ShouldEqual, "plain")
+			So(Normalize(errors.Const("localhost:8080: connection refused")), ShouldEqual,
+				"localhost:8080: connection refused")
+		})
+
+		Convey("for locations inside a line", func() {
+			So(Normalize(fmt.Errorf("ctx: %w", errors.Reason("root"))), ShouldEqual,
+				"ctx: <loc> root")
+			err := errors.AnnotateWith2(errors.Reason("p"), errors.Reason("s"), "outer")
+			So(Normalize(err), ShouldEqual, "<loc> outer\n<loc> p\n(also: <loc> s)")
+		})
+	})
+
+	Convey("Must works", t, func() {
+		var tb fakeTB
+
+		Convey("returns the value on success", func() {
+			So(Must(&tb, 42, nil), ShouldEqual, 42)
+			So(tb.fatal, ShouldEqual, "")
+		})
+
+		Convey("fails with the full error on error", func() {
+			err := errors.Annotate(errors.Reason("because"), "failed")
+			Must(&tb, 0, err)
+			So(tb.fatal, ShouldEqual, "unexpected error:\n"+err.Error())
+		})
+	})
+
+	Convey("AssertDepth works", t, func() {
+		var tb fakeTB
+		err := errors.Annotate(errors.Reason("because"), "failed")
+
+		Convey("passes on the expected depth", func() {
+			AssertDepth(&tb, err, 2)
+			AssertDepth(&tb, nil, 0)
+			So(tb.fatal, ShouldEqual, "")
+		})
+
+		Convey("fails with the full error otherwise", func() {
+			AssertDepth(&tb, err, 3)
+			So(tb.fatal, ShouldEqual, "expected error depth 3, got 2:\n"+err.Error())
+		})
+	})
+}
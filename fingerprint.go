@@ -0,0 +1,127 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// template returns the static part of the error's own message: the unformatted
+// template for annotations ("<lazy>" for LazyReason), the message for Const and
+// Quiet errors, "validation failed" for Validation, and the type for other
+// errors. Returns false for errors without
+// a message of their own, such as panic stacks and metadata.
+func template(err error) (string, bool) {
+	switch v := err.(type) {
+	case *annotatedError:
+		if v.stack != nil {
+			return "", false
+		}
+		return v.format, true
+	case *valueError:
+		return "", false
+	case constError:
+		return string(v), true
+	case quietError:
+		return string(v), true
+	case *validationError:
+		return "validation failed", true
+	default:
+		return fmt.Sprintf("%T", err), true
+	}
+}
+
+// templates returns the templates of all the errors in err's tree.
+func templates(err error) []string {
+	var res []string
+	walk(err, func(e error) bool {
+		if t, ok := template(e); ok {
+			res = append(res, t)
+		}
+		return false
+	})
+	return res
+}
+
+// Fingerprint computes a stable hash of err's tree for grouping errors in
+// error trackers. It is based on the locations (function and line) and the
+// unformatted message templates of the annotations, so errors produced by the
+// same code path with different dynamic arguments have the same fingerprint.
+// Errors not created by this package contribute only their type, except for
+// Const errors which contribute their message. Returns "" for a nil error.
+func Fingerprint(err error) string {
+	if err == nil {
+		return ""
+	}
+	h := sha256.New()
+	walk(err, func(e error) bool {
+		t, ok := template(e)
+		if !ok {
+			return false
+		}
+		if a, ok := e.(*annotatedError); ok {
+			h.Write([]byte(a.frame.Function))
+			h.Write([]byte{0})
+			h.Write([]byte(strconv.Itoa(a.frame.Line)))
+			h.Write([]byte{0})
+		}
+		h.Write([]byte(t))
+		h.Write([]byte{0})
+		return false
+	})
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// SameTemplate checks whether the two errors have the same chains of message
+// templates, regardless of the formatting arguments and locations. This allows
+// tests to assert that the code took a particular error path without depending
+// on dynamic values:
+//
+//	So(errors.SameTemplate(err, errors.Reason("user %s not found", "")), ShouldBeTrue)
+//
+// The templates are compared as in Fingerprint. Two nil errors are the same.
+func SameTemplate(a, b error) bool {
+	ta, tb := templates(a), templates(b)
+	if len(ta) != len(tb) {
+		return false
+	}
+	for i := range ta {
+		if ta[i] != tb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Summary returns a condensed, value-free description of the error suitable as
+// a bounded-cardinality metric label: the outermost non-empty message template
+// as in SameTemplate, without formatting arguments or locations. Returns "" for
+// a nil error.
+func Summary(err error) string {
+	var res string
+	walk(err, func(e error) bool {
+		t, ok := template(e)
+		if ok && strings.TrimSpace(t) != "" {
+			res = t
+			return true
+		}
+		return false
+	})
+	return res
+}
@@ -0,0 +1,82 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFingerprint(t *testing.T) {
+	Convey("Fingerprint works", t, func() {
+		path := func(id int, root error) error {
+			return ann(ann(root, "request %d failed", id), "handler")
+		}
+
+		Convey("nil", func() {
+			So(Fingerprint(nil), ShouldEqual, "")
+		})
+
+		Convey("same path with different args", func() {
+			fp := Fingerprint(path(1, myError("one")))
+			So(fp, ShouldHaveLength, 16)
+			So(Fingerprint(path(2, myError("two"))), ShouldEqual, fp)
+		})
+
+		Convey("different paths", func() {
+			fp := Fingerprint(path(1, myError("one")))
+			So(Fingerprint(ann(myError("one"), "request %d failed", 1)), ShouldNotEqual, fp)
+			So(Fingerprint(path(1, &ptrError{msg: "one"})), ShouldNotEqual, fp)
+			So(Fingerprint(path(1, Const("a"))), ShouldNotEqual, Fingerprint(path(1, Const("b"))))
+			So(Fingerprint(path(1, Quiet("a"))), ShouldNotEqual, Fingerprint(path(1, Quiet("b"))))
+		})
+
+		Convey("ignores metadata and panic stacks", func() {
+			So(Fingerprint(WithSampleKey(path(1, myError("one")), "key")), ShouldEqual,
+				Fingerprint(path(1, myError("one"))))
+			So(Fingerprint(fnA("error")), ShouldEqual,
+				Fingerprint(fnA("error")))
+		})
+	})
+
+	Convey("SameTemplate works", t, func() {
+		So(SameTemplate(nil, nil), ShouldBeTrue)
+		So(SameTemplate(rsn("because"), nil), ShouldBeFalse)
+		So(SameTemplate(
+			ann(Reason("user %s not found", "joe"), "request %d", 1),
+			WithSampleKey(Annotate(Reason("user %s not found", ""), "request %d", 0), "key"),
+		), ShouldBeTrue)
+		So(SameTemplate(Reason("user %s", "joe"), Reason("group %s", "joe")), ShouldBeFalse)
+		So(SameTemplate(ann(myError("a"), "x"), ann(myError("b"), "x")), ShouldBeTrue)
+		So(SameTemplate(ann(myError("a"), "x"), ann(Const("a"), "x")), ShouldBeFalse)
+		So(SameTemplate(ann(myError("a"), "x"), ann(ann(myError("a"), "x"), "y")), ShouldBeFalse)
+		lazy := LazyReason(func() string { return "a" })
+		So(SameTemplate(lazy, LazyReason(func() string { return "b" })), ShouldBeTrue)
+		So(SameTemplate(lazy, rsn("")), ShouldBeFalse)
+	})
+
+	Convey("Summary works", t, func() {
+		So(Summary(nil), ShouldEqual, "")
+		So(Summary(ann(Reason("user %s not found", "joe"), "request %d failed", 1)),
+			ShouldEqual, "request %d failed")
+		So(Summary(ann(WithSampleKey(rsn("because"), "key"), " ")), ShouldEqual, "because")
+		So(Summary(ann(fnA("error"), "")), ShouldEqual, "error in %s")
+		So(Summary(&ptrError{msg: "dynamic 42"}), ShouldEqual, "*errors.ptrError")
+		So(Summary(Const("not found")), ShouldEqual, "not found")
+		So(Summary(Quiet("done")), ShouldEqual, "done")
+		So(Summary(LazyReason(func() string { return "lazy" })), ShouldEqual, "<lazy>")
+	})
+}
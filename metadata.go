@@ -0,0 +1,623 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"os"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// valueError attaches a metadata value to the original error without changing
+// its message.
+type valueError struct {
+	orig  error
+	key   any
+	value any
+}
+
+// Error implements error.
+func (e *valueError) Error() string {
+	return e.orig.Error()
+}
+
+// Unwrap returns the original error.
+func (e *valueError) Unwrap() error {
+	return e.orig
+}
+
+// withValue attaches the key-value pair to the error. If the error is nil,
+// returns nil.
+func withValue(err error, key, value any) error {
+	if err == nil {
+		return nil
+	}
+	return &valueError{orig: err, key: key, value: value}
+}
+
+// lookup returns the value for the key nearest to the top of err's chain.
+func lookup(err error, key any) (value any, ok bool) {
+	walk(err, func(e error) bool {
+		if v, isValue := e.(*valueError); isValue && v.key == key {
+			value, ok = v.value, true
+		}
+		return ok
+	})
+	return
+}
+
+// lookupAll returns all the values for the key in err's chain, nearest first.
+func lookupAll(err error, key any) []any {
+	var values []any
+	walk(err, func(e error) bool {
+		if v, ok := e.(*valueError); ok && v.key == key {
+			values = append(values, v.value)
+		}
+		return false
+	})
+	return values
+}
+
+type sampleKeyKey struct{}
+
+// WithSampleKey attaches a sampling key to the error, e.g. for a logging layer
+// to rate-limit similar errors by key. The key is only carried by the error;
+// the sampling logic is up to the caller. If the error is nil, returns nil.
+func WithSampleKey(err error, key string) error {
+	return withValue(err, sampleKeyKey{}, key)
+}
+
+// SampleKey returns the sampling key nearest to the top of err's chain, if any.
+func SampleKey(err error) (string, bool) {
+	v, ok := lookup(err, sampleKeyKey{})
+	if !ok {
+		return "", false
+	}
+	return v.(string), true
+}
+
+type endpointKey struct{}
+
+// WithEndpoint attaches the endpoint, e.g. a URL or a host:port, which the
+// failed operation was talking to. If err is nil, returns nil.
+func WithEndpoint(err error, endpoint string) error {
+	return withValue(err, endpointKey{}, endpoint)
+}
+
+// Endpoint returns the innermost endpoint attached to err's chain, since the
+// innermost call is the closest to the actual failure.
+func Endpoint(err error) (string, bool) {
+	values := lookupAll(err, endpointKey{})
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1].(string), true
+}
+
+type operationKey struct{}
+
+// WithOperation attaches the name of the logical operation the user was trying
+// to perform, e.g. "CreateUser" or "ChargeCard", for grouping errors by what
+// failed rather than by where it failed. If err is nil, returns nil.
+func WithOperation(err error, op string) error {
+	return withValue(err, operationKey{}, op)
+}
+
+// Operation returns the outermost operation attached to err's chain, since the
+// top-level handler knows the business operation best.
+func Operation(err error) (string, bool) {
+	v, ok := lookup(err, operationKey{})
+	if !ok {
+		return "", false
+	}
+	return v.(string), true
+}
+
+type durationKey struct{}
+
+// AnnotateDuration is the same as Annotate, and additionally records how long
+// the failed operation took, e.g. to distinguish a timeout after 30s from an
+// immediate failure. If err is nil, returns nil.
+func AnnotateDuration(err error, d time.Duration, s string, args ...any) error {
+	if err == nil {
+		return nil
+	}
+	return withValue(annotate(err, 2, s, args...), durationKey{}, d)
+}
+
+// DurationOf returns the operation duration nearest to the top of err's chain.
+func DurationOf(err error) (time.Duration, bool) {
+	v, ok := lookup(err, durationKey{})
+	if !ok {
+		return 0, false
+	}
+	return v.(time.Duration), true
+}
+
+type progressKey struct{}
+
+// AnnotateProgress is the same as Annotate, and additionally records how many
+// bytes, or other units, a streaming operation processed before failing, e.g.
+// to resume it. If err is nil, returns nil.
+func AnnotateProgress(err error, n int64, s string, args ...any) error {
+	if err == nil {
+		return nil
+	}
+	return withValue(annotate(err, 2, s, args...), progressKey{}, n)
+}
+
+// Progress returns the progress nearest to the top of err's chain.
+func Progress(err error) (int64, bool) {
+	v, ok := lookup(err, progressKey{})
+	if !ok {
+		return 0, false
+	}
+	return v.(int64), true
+}
+
+type expectedKey struct{}
+
+// Expected marks the error as expected, e.g. io.EOF used for flow control, so
+// that logging code can stay quiet about it. The mark survives further
+// annotation. If err is nil, returns nil.
+func Expected(err error) error {
+	return withValue(err, expectedKey{}, true)
+}
+
+// IsExpected reports whether err's chain has been marked by Expected.
+func IsExpected(err error) bool {
+	_, ok := lookup(err, expectedKey{})
+	return ok
+}
+
+type permanentKey struct{}
+
+// WithPermanent marks the error as permanent, i.e. not retryable by policy,
+// even if the cause looks temporary (see IsTemporary). If err is nil, returns
+// nil.
+func WithPermanent(err error) error {
+	return withValue(err, permanentKey{}, true)
+}
+
+// IsPermanent reports whether err's chain has been marked by WithPermanent.
+func IsPermanent(err error) bool {
+	_, ok := lookup(err, permanentKey{})
+	return ok
+}
+
+// IsTemporary reports whether some error in err's chain has the Temporary()
+// method returning true, as, for instance, net.Error does, and err is not
+// marked by WithPermanent. Permanent always overrides temporary.
+func IsTemporary(err error) bool {
+	if IsPermanent(err) {
+		return false
+	}
+	return walk(err, func(e error) bool {
+		t, ok := e.(interface{ Temporary() bool })
+		return ok && t.Temporary()
+	})
+}
+
+type scoreKey struct{}
+
+// WithScore attaches an urgency score to the error for alerting rules which
+// compare it against thresholds. The score is clamped to the range [0..100].
+// If err is nil, returns nil.
+func WithScore(err error, score int) error {
+	if score < 0 {
+		score = 0
+	}
+	if score > 100 {
+		score = 100
+	}
+	return withValue(err, scoreKey{}, score)
+}
+
+// ScoreOf returns the highest score attached to err's chain, so that neither
+// annotation nor a lower score added later downgrades the urgency of the error.
+func ScoreOf(err error) (int, bool) {
+	values := lookupAll(err, scoreKey{})
+	if len(values) == 0 {
+		return 0, false
+	}
+	score := 0
+	for _, v := range values {
+		if s := v.(int); s > score {
+			score = s
+		}
+	}
+	return score, true
+}
+
+// Fault classifies who is responsible for an error, e.g. for error budget
+// accounting.
+type Fault int
+
+const (
+	// UnknownFault is the default when no fault is attached.
+	UnknownFault Fault = iota
+	// UserFault is caused by the user, such as invalid input (4xx-ish).
+	UserFault
+	// SystemFault is caused by the system itself (5xx-ish).
+	SystemFault
+	// DependencyFault is caused by an external dependency.
+	DependencyFault
+)
+
+// String implements fmt.Stringer.
+func (f Fault) String() string {
+	switch f {
+	case UserFault:
+		return "user"
+	case SystemFault:
+		return "system"
+	case DependencyFault:
+		return "dependency"
+	default:
+		return "unknown"
+	}
+}
+
+type faultKey struct{}
+
+// WithFault attaches the fault classification to the error. If err is nil,
+// returns nil.
+func WithFault(err error, f Fault) error {
+	return withValue(err, faultKey{}, f)
+}
+
+// FaultOf returns the outermost fault attached to err's chain, allowing callers
+// to reclassify errors of their dependencies, or UnknownFault if none.
+func FaultOf(err error) Fault {
+	v, ok := lookup(err, faultKey{})
+	if !ok {
+		return UnknownFault
+	}
+	return v.(Fault)
+}
+
+type attemptKey struct{}
+
+// WithAttempt records the attempt number n of a retried operation in the error,
+// so that the retry logic can inspect the error to decide whether to stop. If
+// err is nil, returns nil.
+func WithAttempt(err error, n int) error {
+	return withValue(err, attemptKey{}, n)
+}
+
+// Attempts returns the highest attempt number recorded in err's chain, or 0 if
+// there are none.
+func Attempts(err error) int {
+	n := 0
+	for _, v := range lookupAll(err, attemptKey{}) {
+		if a := v.(int); a > n {
+			n = a
+		}
+	}
+	return n
+}
+
+type tagsKey struct{}
+
+// WithTags attaches a set of tags to the error, e.g. "transient" and "network",
+// to be checked by routing rules. Tags survive further annotation. If the error
+// is nil, returns nil.
+func WithTags(err error, tags ...string) error {
+	if len(tags) == 0 {
+		return err
+	}
+	return withValue(err, tagsKey{}, append([]string(nil), tags...))
+}
+
+// Tags returns the sorted and deduplicated list of tags attached anywhere in
+// err's chain.
+func Tags(err error) []string {
+	set := make(map[string]struct{})
+	for _, v := range lookupAll(err, tagsKey{}) {
+		for _, t := range v.([]string) {
+			set[t] = struct{}{}
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	tags := make([]string, 0, len(set))
+	for t := range set {
+		tags = append(tags, t)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// HasTag checks whether the tag is attached anywhere in err's chain.
+func HasTag(err error, tag string) bool {
+	found := false
+	walk(err, func(e error) bool {
+		if v, ok := e.(*valueError); ok && v.key == (tagsKey{}) {
+			for _, t := range v.value.([]string) {
+				if t == tag {
+					found = true
+				}
+			}
+		}
+		return found
+	})
+	return found
+}
+
+// origin identifies the process which created an error.
+type origin struct {
+	host string
+	pid  int
+}
+
+var (
+	originOnce   sync.Once
+	originCached origin
+)
+
+func currentOrigin() *origin {
+	originOnce.Do(func() {
+		originCached.host, _ = os.Hostname()
+		originCached.pid = os.Getpid()
+	})
+	return &originCached
+}
+
+// Origin returns the host name and the process ID recorded in the nearest
+// annotation of err's chain, or zero values if none were recorded. See
+// CaptureOrigin.
+func Origin(err error) (host string, pid int) {
+	walk(err, func(e error) bool {
+		if a, ok := e.(*annotatedError); ok && a.origin != nil {
+			host, pid = a.origin.host, a.origin.pid
+			return true
+		}
+		return false
+	})
+	return
+}
+
+// buildInfo identifies the binary which created an error.
+type buildInfo struct {
+	version  string
+	revision string
+}
+
+type buildInfoKey struct{}
+
+var (
+	buildInfoOnce   sync.Once
+	buildInfoCached buildInfo
+)
+
+func currentBuildInfo() buildInfo {
+	buildInfoOnce.Do(func() {
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		buildInfoCached.version = info.Main.Version
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				buildInfoCached.revision = s.Value
+			}
+		}
+	})
+	return buildInfoCached
+}
+
+// BuildInfo returns the main module version and the VCS revision of the binary
+// recorded in a recovered panic error, or empty strings if none were recorded.
+// Either value may also be empty when not stamped into the binary. See
+// CaptureBuildInfo.
+func BuildInfo(err error) (version, revision string) {
+	v, ok := lookup(err, buildInfoKey{})
+	if !ok {
+		return "", ""
+	}
+	info := v.(buildInfo)
+	return info.version, info.revision
+}
+
+// AnnotateWithFields is the same as Annotate, and additionally attaches the
+// key-value fields to the annotation. The fields map is copied. If err is nil,
+// returns nil.
+func AnnotateWithFields(err error, fields map[string]any, s string, args ...any) error {
+	if err == nil {
+		return nil
+	}
+	a := annotate(err, 2, s, args...)
+	if len(fields) > 0 {
+		a.fields = make(map[string]any, len(fields))
+		for k, v := range fields {
+			a.fields[k] = v
+		}
+	}
+	return a
+}
+
+var (
+	defaultFieldsMu sync.RWMutex
+	defaultFields   map[string]any
+)
+
+// SetDefaultFields sets the fields implicitly attached to all errors, e.g. the
+// service name, version and region. The map is copied, and replaces any
+// previously set defaults; nil clears them. Default fields are a program-wide
+// setting intended to be set once at startup.
+func SetDefaultFields(fields map[string]any) {
+	var m map[string]any
+	if len(fields) > 0 {
+		m = make(map[string]any, len(fields))
+		for k, v := range fields {
+			m[k] = v
+		}
+	}
+	defaultFieldsMu.Lock()
+	defer defaultFieldsMu.Unlock()
+	defaultFields = m
+}
+
+// Fields returns the fields attached to all the annotations in err's chain,
+// merged into a new map together with the default fields (see
+// SetDefaultFields). When the same key appears in several annotations, the
+// outermost one wins; for multi-errors, the first branch in depth-first order
+// wins. Fields attached to the error override the defaults. Thus, repeated calls
+// return equal maps. Returns nil for a nil error or if there are no fields. Use
+// FieldKeys to iterate over the fields in a stable order.
+func Fields(err error) map[string]any {
+	if err == nil {
+		return nil
+	}
+	var res map[string]any
+	walk(err, func(e error) bool {
+		a, ok := e.(*annotatedError)
+		if !ok {
+			return false
+		}
+		for k, v := range a.fields {
+			if res == nil {
+				res = make(map[string]any)
+			}
+			if _, ok := res[k]; !ok {
+				res[k] = v
+			}
+		}
+		return false
+	})
+	return addDefaultFields(res)
+}
+
+// addDefaultFields adds the default fields missing from res, allocating res if
+// necessary.
+func addDefaultFields(res map[string]any) map[string]any {
+	defaultFieldsMu.RLock()
+	defer defaultFieldsMu.RUnlock()
+	for k, v := range defaultFields {
+		if res == nil {
+			res = make(map[string]any)
+		}
+		if _, ok := res[k]; !ok {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// FieldKeys returns the sorted keys of Fields(err), e.g. to produce diffable
+// structured log lines.
+func FieldKeys(err error) []string {
+	fields := Fields(err)
+	if fields == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ReasonKV is the same as Reason, and additionally parses the formatted message
+// as logfmt, attaching the recognized key=value pairs as string fields (see
+// Fields). The message remains unchanged. Values may be quoted to contain
+// spaces, and a backslash escapes the next character, including '=', '"' and a
+// space:
+//
+//	errors.ReasonKV("cannot connect host=%s reason=%q", host, "timed out")
+func ReasonKV(s string, args ...any) error {
+	e := annotate(nil, 2, s, args...)
+	e.fields = parseKV(e.message())
+	return e
+}
+
+// parseKV extracts logfmt key=value pairs from s, or returns nil if there are
+// none.
+func parseKV(s string) map[string]any {
+	var fields map[string]any
+	for _, token := range splitKV(s) {
+		key, value, ok := token.pair()
+		if !ok {
+			continue
+		}
+		if fields == nil {
+			fields = make(map[string]any)
+		}
+		fields[key] = value
+	}
+	return fields
+}
+
+// kvToken is a space-separated token of a logfmt string. Each character is
+// stored with a flag whether it was escaped or quoted, i.e. has no special
+// meaning.
+type kvToken struct {
+	chars   []byte
+	literal []bool
+}
+
+func (t *kvToken) add(c byte, literal bool) {
+	t.chars = append(t.chars, c)
+	t.literal = append(t.literal, literal)
+}
+
+// pair splits the token into a key and a value at the first unescaped '='.
+func (t *kvToken) pair() (key, value string, ok bool) {
+	for i, c := range t.chars {
+		if c == '=' && !t.literal[i] {
+			if i == 0 {
+				return "", "", false
+			}
+			return string(t.chars[:i]), string(t.chars[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// splitKV splits s into tokens separated by unescaped and unquoted spaces,
+// removing quotes and escapes.
+func splitKV(s string) []kvToken {
+	var tokens []kvToken
+	var curr *kvToken
+	start := func() {
+		if curr == nil {
+			tokens = append(tokens, kvToken{})
+			curr = &tokens[len(tokens)-1]
+		}
+	}
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		c, literal := s[i], inQuote
+		switch {
+		case c == '\\' && i+1 < len(s):
+			i++
+			c, literal = s[i], true
+		case c == '"':
+			inQuote = !inQuote
+			start() // an empty quoted string is still a token
+			continue
+		case c == ' ' && !inQuote:
+			curr = nil
+			continue
+		}
+		start()
+		curr.add(c, literal)
+	}
+	return tokens
+}
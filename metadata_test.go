@@ -0,0 +1,363 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// tempError implements the Temporary() convention of net.Error.
+type tempError bool
+
+func (e tempError) Error() string   { return "temp" }
+func (e tempError) Temporary() bool { return bool(e) }
+
+func TestMetadata(t *testing.T) {
+	Convey("Sample key works", t, func() {
+		Convey("nil error stays nil", func() {
+			So(WithSampleKey(nil, "key"), ShouldBeNil)
+			_, ok := SampleKey(nil)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("nearest key wins and survives annotation", func() {
+			inner := WithSampleKey(rsn("because"), "inner")
+			outer := WithSampleKey(ann(inner, "annotated"), "outer")
+			k, ok := SampleKey(ann(outer, "again"))
+			So(ok, ShouldBeTrue)
+			So(k, ShouldEqual, "outer")
+			k, ok = SampleKey(inner)
+			So(ok, ShouldBeTrue)
+			So(k, ShouldEqual, "inner")
+		})
+
+		Convey("message is unchanged", func() {
+			err := rsn("because")
+			So(WithSampleKey(err, "key").Error(), ShouldEqual, err.Error())
+			So(Is(WithSampleKey(err, "key"), err), ShouldBeTrue)
+		})
+
+		Convey("no key", func() {
+			_, ok := SampleKey(rsn("because"))
+			So(ok, ShouldBeFalse)
+		})
+	})
+
+	Convey("Endpoint works", t, func() {
+		So(WithEndpoint(nil, "db:5432"), ShouldBeNil)
+		_, ok := Endpoint(rsn("because"))
+		So(ok, ShouldBeFalse)
+
+		inner := WithEndpoint(rsn("because"), "db:5432")
+		err := WithEndpoint(ann(inner, "query failed"), "https://api.example.com/v1")
+		e, ok := Endpoint(ann(err, "request failed"))
+		So(ok, ShouldBeTrue)
+		So(e, ShouldEqual, "db:5432")
+		So(err.Error(), ShouldEqual, ann(inner, "query failed").Error())
+	})
+
+	Convey("Operation works", t, func() {
+		So(WithOperation(nil, "Op"), ShouldBeNil)
+		_, ok := Operation(rsn("because"))
+		So(ok, ShouldBeFalse)
+
+		err := WithOperation(ann(WithOperation(rsn("because"), "Inner"), "annotated"), "Outer")
+		op, ok := Operation(err)
+		So(ok, ShouldBeTrue)
+		So(op, ShouldEqual, "Outer")
+	})
+
+	Convey("Duration works", t, func() {
+		So(AnnotateDuration(nil, time.Second, "failed"), ShouldBeNil)
+		_, ok := DurationOf(rsn("because"))
+		So(ok, ShouldBeFalse)
+
+		err := AnnotateDuration(rsn("because"), 30*time.Second, "timed out after %s", "30s")
+		So(err.Error(), ShouldContainSubstring, "metadata_test.go:")
+		So(err.Error(), ShouldContainSubstring, "() timed out after 30s\n")
+		d, ok := DurationOf(ann(err, "annotated"))
+		So(ok, ShouldBeTrue)
+		So(d, ShouldEqual, 30*time.Second)
+	})
+
+	Convey("Progress works", t, func() {
+		So(AnnotateProgress(nil, 1, "failed"), ShouldBeNil)
+		_, ok := Progress(rsn("because"))
+		So(ok, ShouldBeFalse)
+
+		err := AnnotateProgress(rsn("because"), 4096, "wrote %d bytes", 4096)
+		So(err.Error(), ShouldContainSubstring, "metadata_test.go:")
+		So(err.Error(), ShouldContainSubstring, "() wrote 4096 bytes\n")
+		n, ok := Progress(ann(err, "annotated"))
+		So(ok, ShouldBeTrue)
+		So(n, ShouldEqual, 4096)
+	})
+
+	Convey("Expected works", t, func() {
+		So(Expected(nil), ShouldBeNil)
+		So(IsExpected(nil), ShouldBeFalse)
+		So(IsExpected(rsn("because")), ShouldBeFalse)
+
+		err := ann(Expected(myError("eof")), "annotated")
+		So(IsExpected(err), ShouldBeTrue)
+		So(Is(err, myError("eof")), ShouldBeTrue)
+		So(Expected(myError("eof")).Error(), ShouldEqual, "eof")
+	})
+
+	Convey("Permanent works", t, func() {
+		temp := tempError(true)
+		So(WithPermanent(nil), ShouldBeNil)
+		So(IsPermanent(nil), ShouldBeFalse)
+		So(IsTemporary(nil), ShouldBeFalse)
+		So(IsTemporary(ann(rsn("because"), "annotated")), ShouldBeFalse)
+		So(IsTemporary(ann(tempError(false), "annotated")), ShouldBeFalse)
+		So(IsTemporary(ann(temp, "annotated")), ShouldBeTrue)
+
+		err := ann(WithPermanent(ann(temp, "inner")), "outer")
+		So(IsPermanent(err), ShouldBeTrue)
+		So(IsTemporary(err), ShouldBeFalse)
+		So(Is(err, temp), ShouldBeTrue)
+		So(IsPermanent(ann(temp, "annotated")), ShouldBeFalse)
+	})
+
+	Convey("Score works", t, func() {
+		So(WithScore(nil, 10), ShouldBeNil)
+		_, ok := ScoreOf(rsn("because"))
+		So(ok, ShouldBeFalse)
+
+		err := ann(WithScore(WithScore(rsn("because"), 70), 20), "annotated")
+		score, ok := ScoreOf(err)
+		So(ok, ShouldBeTrue)
+		So(score, ShouldEqual, 70)
+
+		score, _ = ScoreOf(WithScore(err, 200))
+		So(score, ShouldEqual, 100)
+		score, _ = ScoreOf(WithScore(rsn("because"), -5))
+		So(score, ShouldEqual, 0)
+	})
+
+	Convey("Fault works", t, func() {
+		So(WithFault(nil, UserFault), ShouldBeNil)
+		So(FaultOf(nil), ShouldEqual, UnknownFault)
+		So(FaultOf(rsn("because")), ShouldEqual, UnknownFault)
+
+		inner := WithFault(rsn("because"), DependencyFault)
+		So(FaultOf(ann(inner, "annotated")), ShouldEqual, DependencyFault)
+		So(FaultOf(WithFault(ann(inner, "annotated"), UserFault)), ShouldEqual, UserFault)
+
+		So(UnknownFault.String(), ShouldEqual, "unknown")
+		So(UserFault.String(), ShouldEqual, "user")
+		So(SystemFault.String(), ShouldEqual, "system")
+		So(DependencyFault.String(), ShouldEqual, "dependency")
+	})
+
+	Convey("Attempts work", t, func() {
+		So(WithAttempt(nil, 1), ShouldBeNil)
+		So(Attempts(nil), ShouldEqual, 0)
+		So(Attempts(rsn("because")), ShouldEqual, 0)
+
+		var err error = myError("mine")
+		for i := 1; i <= 3; i++ {
+			err = ann(WithAttempt(err, i), "attempt %d failed", i)
+		}
+		So(Attempts(err), ShouldEqual, 3)
+		So(Attempts(WithAttempt(err, 1)), ShouldEqual, 3)
+	})
+
+	Convey("Tags work", t, func() {
+		Convey("nil error stays nil", func() {
+			So(WithTags(nil, "a"), ShouldBeNil)
+			So(Tags(nil), ShouldBeNil)
+			So(HasTag(nil, "a"), ShouldBeFalse)
+		})
+
+		Convey("no tags is a no-op", func() {
+			err := rsn("because")
+			So(WithTags(err), ShouldEqual, err)
+		})
+
+		Convey("tags are merged across the chain", func() {
+			inner := WithTags(rsn("because"), "transient", "network")
+			err := ann(WithTags(ann(inner, "annotated"), "network", "db"), "again")
+			So(Tags(err), ShouldResemble, []string{"db", "network", "transient"})
+			So(HasTag(err, "transient"), ShouldBeTrue)
+			So(HasTag(err, "db"), ShouldBeTrue)
+			So(HasTag(err, "other"), ShouldBeFalse)
+			So(Tags(inner), ShouldResemble, []string{"network", "transient"})
+			So(Tags(rsn("because")), ShouldBeNil)
+		})
+	})
+
+	Convey("Origin works", t, func() {
+		Convey("not captured by default", func() {
+			host, pid := Origin(rsn("because"))
+			So(host, ShouldEqual, "")
+			So(pid, ShouldEqual, 0)
+		})
+
+		Convey("captured when enabled", func() {
+			CaptureOrigin(true)
+			err := rsn("because")
+			CaptureOrigin(false)
+
+			expected, _ := os.Hostname()
+			host, pid := Origin(ann(err, "annotated"))
+			So(host, ShouldEqual, expected)
+			So(pid, ShouldEqual, os.Getpid())
+		})
+	})
+
+	Convey("BuildInfo works", t, func() {
+		Convey("not captured by default", func() {
+			_, ok := lookup(fnA("error"), buildInfoKey{})
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("captured when enabled", func() {
+			CaptureBuildInfo(true)
+			err := fnA("error")
+			CaptureBuildInfo(false)
+
+			_, ok := lookup(err, buildInfoKey{})
+			So(ok, ShouldBeTrue)
+			So(FromPanicOrigin(err), ShouldBeTrue)
+			version, revision := BuildInfo(ann(err, "annotated"))
+			So(version, ShouldEqual, currentBuildInfo().version)
+			So(revision, ShouldEqual, currentBuildInfo().revision)
+		})
+
+		Convey("not captured for normal errors", func() {
+			CaptureBuildInfo(true)
+			defer CaptureBuildInfo(false)
+			version, revision := BuildInfo(rsn("because"))
+			So(version, ShouldEqual, "")
+			So(revision, ShouldEqual, "")
+		})
+	})
+
+	Convey("Fields work", t, func() {
+		Convey("nil stays nil", func() {
+			So(AnnotateWithFields(nil, map[string]any{"a": 1}, "failed"), ShouldBeNil)
+			So(Fields(nil), ShouldBeNil)
+		})
+
+		Convey("annotates with fields", func() {
+			fields := map[string]any{"a": 1}
+			err := AnnotateWithFields(myError("mine"), fields, "failed %d", 2)
+			fields["a"] = 10
+			So(err.Error(), ShouldContainSubstring, "metadata_test.go:")
+			So(err.Error(), ShouldContainSubstring, "() failed 2\nmine")
+			So(Fields(err), ShouldResemble, map[string]any{"a": 1})
+		})
+
+		Convey("outer fields override inner ones", func() {
+			inner := AnnotateWithFields(rsn("because"), map[string]any{"a": 1, "b": 2}, "inner")
+			outer := AnnotateWithFields(ann(inner, "middle"), map[string]any{"b": 3, "c": 4}, "outer")
+			So(Fields(outer), ShouldResemble, map[string]any{"a": 1, "b": 3, "c": 4})
+			So(Fields(inner), ShouldResemble, map[string]any{"a": 1, "b": 2})
+		})
+
+		Convey("default fields", func() {
+			defaults := map[string]any{"service": "svc", "a": 0}
+			SetDefaultFields(defaults)
+			defer SetDefaultFields(nil)
+			defaults["service"] = "modified"
+
+			So(Fields(nil), ShouldBeNil)
+			So(Fields(rsn("because")), ShouldResemble, map[string]any{"service": "svc", "a": 0})
+			err := AnnotateWithFields(rsn("because"), map[string]any{"a": 1}, "failed")
+			So(Fields(err), ShouldResemble, map[string]any{"service": "svc", "a": 1})
+		})
+
+		Convey("merge is deterministic", func() {
+			left := AnnotateWithFields(rsn("left"), map[string]any{"a": 1, "b": 1}, "left")
+			right := AnnotateWithFields(rsn("right"), map[string]any{"a": 2, "c": 2}, "right")
+			err := AnnotateWithFields(&multiError{errs: []error{left, right}},
+				map[string]any{"d": 3}, "outer")
+			expected := map[string]any{"a": 1, "b": 1, "c": 2, "d": 3}
+			for i := 0; i < 10; i++ {
+				So(Fields(err), ShouldResemble, expected)
+				So(FieldKeys(err), ShouldResemble, []string{"a", "b", "c", "d"})
+			}
+			So(FieldKeys(rsn("because")), ShouldBeNil)
+		})
+
+		Convey("no fields", func() {
+			So(Fields(ann(rsn("because"), "failed")), ShouldBeNil)
+			So(Fields(AnnotateWithFields(rsn("because"), nil, "failed")), ShouldBeNil)
+		})
+	})
+
+	Convey("ReasonKV works", t, func() {
+		Convey("keeps the message and extracts fields", func() {
+			err := ReasonKV(`cannot connect host=%s port=%d reason=%q expr=a\=b empty="" x = y`,
+				"example.com", 80, "timed out")
+			So(err.Error(), ShouldContainSubstring, "metadata_test.go:")
+			So(err.Error(), ShouldEndWith,
+				`() cannot connect host=example.com port=80 reason="timed out" expr=a\=b empty="" x = y`)
+			So(Fields(err), ShouldResemble, map[string]any{
+				"host":   "example.com",
+				"port":   "80",
+				"reason": "timed out",
+				"expr":   "a=b",
+				"empty":  "",
+			})
+		})
+
+		Convey("escaped quotes and spaces", func() {
+			err := ReasonKV(`failed msg="say \"hi\"" path=a\ b`)
+			So(Fields(err), ShouldResemble, map[string]any{
+				"msg":  `say "hi"`,
+				"path": "a b",
+			})
+		})
+
+		Convey("no fields", func() {
+			So(Fields(ReasonKV("just a message = nothing")), ShouldBeNil)
+			So(Fields(ReasonKV(`"k=v" \=v`)), ShouldBeNil)
+		})
+	})
+
+	// This test is meaningful when run with -race.
+	Convey("metadata helpers are safe for concurrent use", t, func() {
+		base := AnnotateWithFields(rsn("because"), map[string]any{"a": 1}, "base")
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(2)
+			go func(i int) {
+				defer wg.Done()
+				err := WithTags(AnnotateWithFields(base, map[string]any{"a": i}, "wrap %d", i), "t")
+				_ = WithScore(WithOperation(err, "Op"), i).Error()
+				_ = BuildFrom(base, "built").Field("a", i).Err()
+				_ = AnnotateOnce(base, "key", "once")
+			}(i)
+			go func() {
+				defer wg.Done()
+				_ = base.Error()
+				_ = Fields(base)
+				_ = Attributes(base)
+				_ = Redact(base)
+			}()
+		}
+		wg.Wait()
+		So(Fields(base), ShouldResemble, map[string]any{"a": 1})
+		So(Tags(base), ShouldBeNil)
+	})
+}
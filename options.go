@@ -0,0 +1,256 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// boolOption is a package-level boolean option safe for concurrent use.
+type boolOption struct {
+	v int32
+}
+
+func (o *boolOption) set(b bool) {
+	var v int32
+	if b {
+		v = 1
+	}
+	atomic.StoreInt32(&o.v, v)
+}
+
+func (o *boolOption) get() bool {
+	return atomic.LoadInt32(&o.v) != 0
+}
+
+// intOption is a package-level integer option safe for concurrent use.
+type intOption struct {
+	v int64
+}
+
+func (o *intOption) set(n int) {
+	atomic.StoreInt64(&o.v, int64(n))
+}
+
+func (o *intOption) get() int {
+	return int(atomic.LoadInt64(&o.v))
+}
+
+var dedupAnnotations boolOption
+
+// DedupAnnotations enables or disables collapsing of identical adjacent
+// annotations. When enabled, annotating an error whose outermost annotation has
+// exactly the same message (ignoring the location) does not add a new layer,
+// but increments its repeat counter rendered as "(xN)". This keeps errors
+// compact in retry loops. Default is off.
+func DedupAnnotations(on bool) {
+	dedupAnnotations.set(on)
+}
+
+var captureOrigin boolOption
+
+// CaptureOrigin enables or disables recording of the host name and the process
+// ID in the errors created by this package, to be retrieved by Origin. The
+// values are looked up once and cached. Default is off.
+func CaptureOrigin(on bool) {
+	captureOrigin.set(on)
+}
+
+var normalizeSeparators boolOption
+
+// NormalizeSeparators enables or disables rendering of file paths in locations
+// with "/" as the separator regardless of the OS, e.g. to make error strings
+// portable in golden tests. Default is off, rendering paths as captured.
+func NormalizeSeparators(on bool) {
+	normalizeSeparators.set(on)
+}
+
+var captureBuildInfo boolOption
+
+// CaptureBuildInfo enables or disables recording of the main module version and
+// the VCS revision of the binary in the errors recovered by FromPanic, to be
+// retrieved by BuildInfo. The values are read once and cached. Default is off.
+func CaptureBuildInfo(on bool) {
+	captureBuildInfo.set(on)
+}
+
+var (
+	metricsEnabled boolOption
+	metricsMu      sync.Mutex
+	metrics        map[string]int64
+)
+
+// EnableMetrics enables counting of the annotations created by this package
+// per message template, e.g. to find code creating errors in tight loops. The
+// counts are retrieved by Metrics. Counting is off by default, and adds no
+// overhead until enabled.
+func EnableMetrics() {
+	metricsEnabled.set(true)
+}
+
+// Metrics returns a copy of the annotation counts keyed by message template,
+// as in Reason("failed %d", n) counted as "failed %d". Returns nil if metrics
+// are not enabled.
+func Metrics() map[string]int64 {
+	if !metricsEnabled.get() {
+		return nil
+	}
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	res := make(map[string]int64, len(metrics))
+	for k, v := range metrics {
+		res[k] = v
+	}
+	return res
+}
+
+// countTemplate increments the count of the template when metrics are enabled.
+func countTemplate(template string) {
+	if !metricsEnabled.get() {
+		return
+	}
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	if metrics == nil {
+		metrics = make(map[string]int64)
+	}
+	metrics[template]++
+}
+
+var suppressDuplicateLocations boolOption
+
+// SuppressDuplicateLocations enables or disables omitting the location of an
+// annotation which is exactly the same as the location of the annotation it
+// wraps, e.g. in recursive or retrying functions, rendering only its message.
+// The chain itself remains unchanged. Default is off, rendering all locations.
+func SuppressDuplicateLocations(on bool) {
+	suppressDuplicateLocations.set(on)
+}
+
+const formattingErrorMarker = "[FORMATTING ERROR]"
+
+var strictFormat boolOption
+
+// StrictFormat enables or disables detection of mismatched format verbs and
+// arguments in error messages, such as Reason("value %d", "str"). When enabled,
+// a message containing fmt's "%!" error marker is followed by
+// "[FORMATTING ERROR]" to make such bugs easy to spot. Default is off, keeping
+// the standard fmt behavior.
+func StrictFormat(on bool) {
+	strictFormat.set(on)
+}
+
+var maxPanicFrames intOption
+
+// MaxPanicFrames limits the number of panic stack frames rendered for errors
+// produced by FromPanic. When a stack has more than n frames, only the first
+// and the last frames are rendered, with the number of omitted frames in
+// between. The full stack remains available via StackTrace. A non-positive n
+// means no limit, which is the default.
+func MaxPanicFrames(n int) {
+	maxPanicFrames.set(n)
+}
+
+var includeRevision boolOption
+
+// IncludeRevision enables or disables rendering of the short VCS revision of
+// the binary after the line number of each location, as in
+// "file.go:26@1a2b3c4: pkg.Func()", so that locations reported by production
+// binaries can be resolved in the matching source tree. The revision is read
+// once from the build information stamped by the Go toolchain; when it is
+// missing, locations are rendered as usual. Default is off.
+func IncludeRevision(on bool) {
+	includeRevision.set(on)
+}
+
+// LocationStyle selects how locations are rendered.
+type LocationStyle int
+
+const (
+	// FullPath renders "/path/to/file.go:26: example.com/pkg.Func()". This is
+	// the default.
+	FullPath LocationStyle = iota
+	// FileLine renders "file.go:26: example.com/pkg.Func()".
+	FileLine
+	// FuncLine renders "pkg.Func:26:".
+	FuncLine
+)
+
+var locationStyle intOption
+
+// SetLocationStyle sets the style of rendered locations.
+func SetLocationStyle(s LocationStyle) {
+	locationStyle.set(int(s))
+}
+
+func init() {
+	applyEnv(os.Getenv)
+}
+
+// applyEnv sets the options from the environment variables, allowing operators
+// to tune the output without code changes:
+//
+//   - ERRORS_LOCATION_STYLE: "full", "file" or "func" (see SetLocationStyle);
+//   - ERRORS_CHAIN_SEP: the Separator of DefaultRenderer, with Go escapes such
+//     as "\n" interpreted;
+//   - ERRORS_MAX_PANIC_FRAMES: an integer (see MaxPanicFrames);
+//   - ERRORS_DEDUP, ERRORS_CAPTURE_ORIGIN, ERRORS_CAPTURE_BUILD_INFO,
+//     ERRORS_NORMALIZE_SEPARATORS, ERRORS_STRICT_FORMAT,
+//     ERRORS_SUPPRESS_DUPLICATE_LOCATIONS, ERRORS_INCLUDE_REVISION: booleans as
+//     accepted by strconv.ParseBool (see DedupAnnotations, CaptureOrigin,
+//     CaptureBuildInfo, NormalizeSeparators, StrictFormat,
+//     SuppressDuplicateLocations, IncludeRevision).
+//
+// Unset or invalid values keep the defaults. The variables are read once at
+// program initialization, so explicit calls to the option setters override
+// them.
+func applyEnv(getenv func(string) string) {
+	switch getenv("ERRORS_LOCATION_STYLE") {
+	case "full":
+		SetLocationStyle(FullPath)
+	case "file":
+		SetLocationStyle(FileLine)
+	case "func":
+		SetLocationStyle(FuncLine)
+	}
+	if v := getenv("ERRORS_CHAIN_SEP"); v != "" {
+		if unquoted, err := strconv.Unquote(`"` + v + `"`); err == nil {
+			v = unquoted
+		}
+		if r, ok := DefaultRenderer.(TextRenderer); ok {
+			r.Separator = v
+			DefaultRenderer = r
+		}
+	}
+	if n, err := strconv.Atoi(getenv("ERRORS_MAX_PANIC_FRAMES")); err == nil {
+		MaxPanicFrames(n)
+	}
+	for name, set := range map[string]func(bool){
+		"ERRORS_DEDUP":                        DedupAnnotations,
+		"ERRORS_CAPTURE_ORIGIN":               CaptureOrigin,
+		"ERRORS_CAPTURE_BUILD_INFO":           CaptureBuildInfo,
+		"ERRORS_NORMALIZE_SEPARATORS":         NormalizeSeparators,
+		"ERRORS_STRICT_FORMAT":                StrictFormat,
+		"ERRORS_SUPPRESS_DUPLICATE_LOCATIONS": SuppressDuplicateLocations,
+		"ERRORS_INCLUDE_REVISION":             IncludeRevision,
+	} {
+		if on, err := strconv.ParseBool(getenv(name)); err == nil {
+			set(on)
+		}
+	}
+}
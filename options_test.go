@@ -0,0 +1,320 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOptions(t *testing.T) {
+	Convey("DedupAnnotations works", t, func() {
+		retry := func(err error, n int) error {
+			for i := 0; i < n; i++ {
+				err = ann(err, "retry failed")
+			}
+			return err
+		}
+
+		Convey("off by default", func() {
+			err := retry(rsn("because"), 3)
+			So(strings.Count(err.Error(), "retry failed"), ShouldEqual, 3)
+			So(err.Error(), ShouldNotContainSubstring, "(x")
+		})
+
+		Convey("collapses identical annotations when enabled", func() {
+			DedupAnnotations(true)
+			defer DedupAnnotations(false)
+
+			base := rsn("because")
+			err := retry(base, 3)
+			So(strings.Count(err.Error(), "retry failed"), ShouldEqual, 1)
+			So(err.Error(), ShouldContainSubstring,
+				"errors_test.go:31: github.com/stockparfait/errors.ann() retry failed (x3)\n")
+			So(Is(err, base), ShouldBeTrue)
+		})
+
+		Convey("keeps different messages", func() {
+			DedupAnnotations(true)
+			defer DedupAnnotations(false)
+
+			err := ann(ann(rsn("because"), "first"), "second")
+			So(err.Error(), ShouldContainSubstring, "first\n")
+			So(err.Error(), ShouldContainSubstring, "second\n")
+			So(err.Error(), ShouldNotContainSubstring, "(x")
+		})
+	})
+
+	Convey("NormalizeSeparators works", t, func() {
+		err := &annotatedError{
+			frame:  Frame{File: `C:\src\a.go`, Line: 1, Function: "pkg.A"},
+			format: "failed",
+		}
+
+		Convey("off by default", func() {
+			So(err.Error(), ShouldEqual, `ERROR: C:\src\a.go:1: pkg.A() failed`)
+		})
+
+		Convey("when enabled", func() {
+			NormalizeSeparators(true)
+			defer NormalizeSeparators(false)
+			So(err.Error(), ShouldEqual, `ERROR: C:/src/a.go:1: pkg.A() failed`)
+		})
+	})
+
+	Convey("StrictFormat works", t, func() {
+		// Non-constant format avoids vet warnings on the intentional mismatches.
+		format := "value %d"
+		var noArgs []any
+		Convey("off by default", func() {
+			So(ann(myError("mine"), format, "str").Error(), ShouldContainSubstring,
+				"ann() value %!d(string=str)\n")
+		})
+
+		Convey("marks formatting errors when enabled", func() {
+			StrictFormat(true)
+			defer StrictFormat(false)
+			So(ann(myError("mine"), format, "str").Error(), ShouldContainSubstring,
+				"ann() value %!d(string=str) [FORMATTING ERROR]\n")
+			So(ann(myError("mine"), "value %d", 1).Error(), ShouldContainSubstring,
+				"ann() value 1\n")
+			So(ann(myError("mine"), format, noArgs...).Error(), ShouldContainSubstring,
+				"ann() value %!d(MISSING) [FORMATTING ERROR]\n")
+		})
+	})
+
+	Convey("MaxPanicFrames works", t, func() {
+		err := &annotatedError{
+			orig: myError("mine"),
+			stack: []Frame{
+				{File: "a.go", Line: 1, Function: "pkg.A"},
+				{File: "b.go", Line: 2, Function: "pkg.B"},
+				{File: "c.go", Line: 3, Function: "pkg.C"},
+				{File: "d.go", Line: 4, Function: "pkg.D"},
+				{File: "e.go", Line: 5, Function: "pkg.E"},
+			},
+		}
+
+		Convey("unlimited by default", func() {
+			So(err.Error(), ShouldEqual, `PANIC: a.go:1: pkg.A()
+PANIC: b.go:2: pkg.B()
+PANIC: c.go:3: pkg.C()
+PANIC: d.go:4: pkg.D()
+PANIC: e.go:5: pkg.E()
+mine`)
+		})
+
+		Convey("omits the middle frames when limited", func() {
+			defer MaxPanicFrames(0)
+			MaxPanicFrames(3)
+			So(err.Error(), ShouldEqual, `PANIC: a.go:1: pkg.A()
+PANIC: b.go:2: pkg.B()
+PANIC: ... 2 frames omitted ...
+PANIC: e.go:5: pkg.E()
+mine`)
+			MaxPanicFrames(5)
+			So(err.Error(), ShouldNotContainSubstring, "omitted")
+			So(StackTrace(ann(err, "annotated")), ShouldResemble, err.stack)
+		})
+	})
+
+	Convey("SetLocationStyle works", t, func() {
+		defer SetLocationStyle(FullPath)
+		err := ann(rsn("because"), "failed")
+
+		Convey("FullPath", func() {
+			So(err.Error(), ShouldContainSubstring,
+				"/errors_test.go:26: github.com/stockparfait/errors.rsn() because")
+		})
+
+		Convey("FileLine", func() {
+			SetLocationStyle(FileLine)
+			So(err.Error(), ShouldEqual,
+				"ERROR: errors_test.go:31: github.com/stockparfait/errors.ann() failed\n"+
+					"ERROR: errors_test.go:26: github.com/stockparfait/errors.rsn() because")
+		})
+
+		Convey("FuncLine", func() {
+			SetLocationStyle(FuncLine)
+			So(err.Error(), ShouldEqual,
+				"ERROR: errors.ann:31: failed\nERROR: errors.rsn:26: because")
+		})
+
+		Convey("FileLine with Windows paths", func() {
+			SetLocationStyle(FileLine)
+			e := &annotatedError{
+				frame:  Frame{File: `C:\src\a.go`, Line: 1, Function: "pkg.A"},
+				format: "failed",
+			}
+			So(e.Error(), ShouldEqual, "ERROR: a.go:1: pkg.A() failed")
+		})
+	})
+
+	Convey("applyEnv works", t, func() {
+		savedRenderer := DefaultRenderer
+		defer func() {
+			DefaultRenderer = savedRenderer
+			SetLocationStyle(FullPath)
+			MaxPanicFrames(0)
+			DedupAnnotations(false)
+			CaptureOrigin(false)
+			CaptureBuildInfo(false)
+			NormalizeSeparators(false)
+			StrictFormat(false)
+			SuppressDuplicateLocations(false)
+			IncludeRevision(false)
+		}()
+
+		Convey("keeps the defaults when unset", func() {
+			applyEnv(func(string) string { return "" })
+			So(DefaultRenderer, ShouldResemble, savedRenderer)
+			So(LocationStyle(locationStyle.get()), ShouldEqual, FullPath)
+			So(maxPanicFrames.get(), ShouldEqual, 0)
+			So(dedupAnnotations.get(), ShouldBeFalse)
+		})
+
+		Convey("sets the options", func() {
+			env := map[string]string{
+				"ERRORS_LOCATION_STYLE":               "func",
+				"ERRORS_CHAIN_SEP":                    ` | \t`,
+				"ERRORS_MAX_PANIC_FRAMES":             "10",
+				"ERRORS_DEDUP":                        "true",
+				"ERRORS_CAPTURE_ORIGIN":               "1",
+				"ERRORS_CAPTURE_BUILD_INFO":           "true",
+				"ERRORS_NORMALIZE_SEPARATORS":         "t",
+				"ERRORS_STRICT_FORMAT":                "TRUE",
+				"ERRORS_SUPPRESS_DUPLICATE_LOCATIONS": "true",
+				"ERRORS_INCLUDE_REVISION":             "0",
+			}
+			applyEnv(func(k string) string { return env[k] })
+			So(DefaultRenderer.(TextRenderer).Separator, ShouldEqual, " | \t")
+			So(LocationStyle(locationStyle.get()), ShouldEqual, FuncLine)
+			So(maxPanicFrames.get(), ShouldEqual, 10)
+			So(dedupAnnotations.get(), ShouldBeTrue)
+			So(captureOrigin.get(), ShouldBeTrue)
+			So(captureBuildInfo.get(), ShouldBeTrue)
+			So(normalizeSeparators.get(), ShouldBeTrue)
+			So(strictFormat.get(), ShouldBeTrue)
+			So(suppressDuplicateLocations.get(), ShouldBeTrue)
+			So(includeRevision.get(), ShouldBeFalse)
+			So(ann(rsn("because"), "failed").Error(), ShouldEqual,
+				"ERROR: errors.ann:31: failed | \tERROR: errors.rsn:26: because")
+		})
+
+		Convey("ignores invalid values", func() {
+			env := map[string]string{
+				"ERRORS_LOCATION_STYLE":   "short",
+				"ERRORS_MAX_PANIC_FRAMES": "many",
+				"ERRORS_DEDUP":            "yes",
+			}
+			applyEnv(func(k string) string { return env[k] })
+			So(LocationStyle(locationStyle.get()), ShouldEqual, FullPath)
+			So(maxPanicFrames.get(), ShouldEqual, 0)
+			So(dedupAnnotations.get(), ShouldBeFalse)
+		})
+	})
+
+	Convey("Metrics work", t, func() {
+		defer func() {
+			metricsEnabled.set(false)
+			metrics = nil
+		}()
+
+		rsn("because")
+		So(Metrics(), ShouldBeNil)
+
+		EnableMetrics()
+		So(Metrics(), ShouldResemble, map[string]int64{})
+		for i := 0; i < 3; i++ {
+			_ = ann(Reason("failed %d", i), "annotated")
+		}
+		_ = LazyReason(func() string { return "lazy" })
+		_ = AnnotateAll(myError("mine"), "first", "second")
+		m := Metrics()
+		So(m, ShouldResemble, map[string]int64{
+			"failed %d": 3, "annotated": 3, "<lazy>": 1, "first": 1, "second": 1,
+		})
+		m["annotated"] = 0
+		So(Metrics()["annotated"], ShouldEqual, 3)
+	})
+
+	Convey("SuppressDuplicateLocations works", t, func() {
+		loc := Frame{File: "a.go", Line: 1, Function: "pkg.A"}
+		err := &annotatedError{
+			orig: &annotatedError{
+				orig: &annotatedError{
+					orig:  &annotatedError{orig: myError("root"), frame: loc, format: "first"},
+					frame: loc,
+				},
+				frame:  loc,
+				format: "third",
+			},
+			frame:  Frame{File: "b.go", Line: 2, Function: "pkg.B"},
+			format: "outer",
+		}
+
+		Convey("off by default", func() {
+			So(err.Error(), ShouldEqual, `ERROR: b.go:2: pkg.B() outer
+ERROR: a.go:1: pkg.A() third
+ERROR: a.go:1: pkg.A()
+ERROR: a.go:1: pkg.A() first
+root`)
+		})
+
+		Convey("when enabled", func() {
+			SuppressDuplicateLocations(true)
+			defer SuppressDuplicateLocations(false)
+			So(err.Error(), ShouldEqual, `ERROR: b.go:2: pkg.B() outer
+ERROR: third
+ERROR:
+ERROR: a.go:1: pkg.A() first
+root`)
+		})
+	})
+
+	Convey("IncludeRevision works", t, func() {
+		currentBuildInfo() // make sure the cache is initialized
+		saved := buildInfoCached
+		defer func() {
+			buildInfoCached = saved
+			IncludeRevision(false)
+			SetLocationStyle(FullPath)
+		}()
+		buildInfoCached.revision = "0123456789abcdef"
+		err := &annotatedError{
+			frame:  Frame{File: "a.go", Line: 1, Function: "pkg.A"},
+			format: "failed",
+		}
+
+		Convey("off by default", func() {
+			So(err.Error(), ShouldEqual, "ERROR: a.go:1: pkg.A() failed")
+		})
+
+		Convey("when enabled", func() {
+			IncludeRevision(true)
+			So(err.Error(), ShouldEqual, "ERROR: a.go:1@0123456: pkg.A() failed")
+			SetLocationStyle(FuncLine)
+			So(err.Error(), ShouldEqual, "ERROR: pkg.A:1@0123456: failed")
+		})
+
+		Convey("when the revision is unknown", func() {
+			IncludeRevision(true)
+			buildInfoCached.revision = ""
+			So(err.Error(), ShouldEqual, "ERROR: a.go:1: pkg.A() failed")
+		})
+	})
+}
@@ -0,0 +1,202 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"regexp"
+	"sync"
+)
+
+type redactor struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+var (
+	redactorsMu sync.RWMutex
+	redactors   []redactor
+)
+
+// RegisterRedactor adds a pattern to be scrubbed from error messages by
+// Redact, e.g. e-mail addresses or access tokens. The replacement may refer to
+// the submatches as in regexp.Regexp.ReplaceAllString.
+func RegisterRedactor(re *regexp.Regexp, replacement string) {
+	redactorsMu.Lock()
+	defer redactorsMu.Unlock()
+	redactors = append(redactors, redactor{re: re, replacement: replacement})
+}
+
+// redactString applies all the registered redactors to s.
+func redactString(s string) string {
+	redactorsMu.RLock()
+	defer redactorsMu.RUnlock()
+	for _, r := range redactors {
+		s = r.re.ReplaceAllString(s, r.replacement)
+	}
+	return s
+}
+
+// redactedError replaces the message of an error not created by this package.
+type redactedError struct {
+	orig    error
+	msg     string
+	wrapped []error // redacted errors wrapped by orig, for foreignMessage
+}
+
+// Error implements error.
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the original error.
+func (e *redactedError) Unwrap() error {
+	return e.orig
+}
+
+// Redact returns a copy of err with all the messages in its chain rewritten by
+// the registered redactors (see RegisterRedactor). The original error is not
+// modified. The message templates are kept, so that Summary, SameTemplate and
+// Fingerprint of the redacted error are the same as of the original. Errors not
+// created by this package are replaced by their redacted message which still
+// unwraps to the original error for Is and As. Brief, Plainify and Info render
+// such errors only from their redacted parts. If err is nil, returns nil.
+func Redact(err error) error {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *annotatedError:
+		if e == nil {
+			return err
+		}
+		res := *e
+		msg := redactString(e.message())
+		res.args = nil
+		res.lazy = &lazyMessage{f: func() string { return msg }}
+		res.orig = Redact(e.orig)
+		res.also = Redact(e.also)
+		return &res
+	case *valueError:
+		res := *e
+		res.orig = Redact(e.orig)
+		return &res
+	case *plainError:
+		return &plainError{orig: Redact(e.orig)}
+	default:
+		res := &redactedError{orig: err, msg: redactString(err.Error())}
+		switch u := err.(type) {
+		case interface{ Unwrap() error }:
+			res.wrapped = []error{Redact(u.Unwrap())}
+		case interface{ Unwrap() []error }:
+			for _, e := range u.Unwrap() {
+				res.wrapped = append(res.wrapped, Redact(e))
+			}
+		}
+		return res
+	}
+}
+
+// rebuiltError replaces an error not created by this package whose wrapped
+// errors were rebuilt by RemoveLayers.
+type rebuiltError struct {
+	msg     string
+	wrapped []error
+}
+
+// Error implements error.
+func (e *rebuiltError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the rebuilt wrapped errors.
+func (e *rebuiltError) Unwrap() []error {
+	return e.wrapped
+}
+
+// RemoveLayers rebuilds err's chain without the layers for which pred returns
+// true, e.g. to drop an annotation exposing internal details such as an SQL
+// query before the error crosses a trust boundary. The predicate is called with
+// each layer created by this package, including its original error, also when
+// wrapped by errors from other packages, such as fmt.Errorf with %w or
+// multi-errors. The root cause, i.e. the innermost error of the chain, is
+// always preserved, as well as any errors from other packages. However, a
+// foreign wrapper of a removed layer is replaced by an error with its message
+// re-rendered without the layer, which unwraps to the rebuilt wrapped errors,
+// so As no longer matches the wrapper itself. The original chain remains
+// unmodified.
+func RemoveLayers(err error, pred func(error) bool) error {
+	res, _ := removeLayers(err, pred)
+	return res
+}
+
+// removeLayers implements RemoveLayers, and reports whether the chain changed.
+func removeLayers(err error, pred func(error) bool) (error, bool) {
+	var orig error
+	switch e := err.(type) {
+	case *annotatedError:
+		if e != nil {
+			orig = e.orig
+		}
+	case *valueError:
+		orig = e.orig
+	case *plainError:
+		orig = e.orig
+	default:
+		return removeForeignLayers(err, pred)
+	}
+	if orig == nil {
+		return err, false
+	}
+	newOrig, changed := removeLayers(orig, pred)
+	if pred(err) {
+		return newOrig, true
+	}
+	if !changed {
+		return err, false
+	}
+	switch e := err.(type) {
+	case *annotatedError:
+		res := *e
+		res.orig = newOrig
+		return &res, true
+	case *valueError:
+		res := *e
+		res.orig = newOrig
+		return &res, true
+	default:
+		return &plainError{orig: newOrig}, true
+	}
+}
+
+// removeForeignLayers applies removeLayers to the errors wrapped by an error
+// not created by this package, and rebuilds it if any of them changed.
+func removeForeignLayers(err error, pred func(error) bool) (error, bool) {
+	var res []error
+	var from, to []string
+	changed := false
+	for _, e := range wrappedErrors(err) {
+		if e == nil {
+			continue
+		}
+		r, ok := removeLayers(e, pred)
+		changed = changed || ok
+		res = append(res, r)
+		from = append(from, e.Error())
+		to = append(to, r.Error())
+	}
+	if !changed {
+		return err, false
+	}
+	return &rebuiltError{msg: replaceMessages(err.Error(), from, to), wrapped: res}, true
+}
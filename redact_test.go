@@ -0,0 +1,144 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRedact(t *testing.T) {
+	Convey("Redact works", t, func() {
+		defer func() { redactors = nil }()
+		RegisterRedactor(regexp.MustCompile(`[a-z]+@[a-z.]+`), "<email>")
+		RegisterRedactor(regexp.MustCompile(`token=(\w)\w*`), "token=$1***")
+
+		Convey("nil stays nil", func() {
+			So(Redact(nil), ShouldBeNil)
+		})
+
+		Convey("redacts the whole chain", func() {
+			root := myError("no user joe@example.com")
+			err := ann(WithSampleKey(ann(root, "token=secret"), "key"), "for bob@example.org")
+			red := Redact(err)
+			So(red.Error(), ShouldNotContainSubstring, "joe@")
+			So(red.Error(), ShouldNotContainSubstring, "bob@")
+			So(red.Error(), ShouldNotContainSubstring, "secret")
+			So(red.Error(), ShouldContainSubstring, "ann() for <email>\n")
+			So(red.Error(), ShouldContainSubstring, "ann() token=s***\n")
+			So(red.Error(), ShouldEndWith, "\nno user <email>")
+			So(Is(red, root), ShouldBeTrue)
+			k, _ := SampleKey(red)
+			So(k, ShouldEqual, "key")
+
+			Convey("leaving the original intact", func() {
+				So(err.Error(), ShouldContainSubstring, "bob@example.org")
+				So(err.Error(), ShouldContainSubstring, "token=secret")
+			})
+		})
+
+		Convey("keeps percent signs", func() {
+			red := Redact(ann(myError("mine"), "100%% of %s", "joe@example.com"))
+			So(red.Error(), ShouldContainSubstring, "ann() 100% of <email>\n")
+		})
+
+		Convey("redacts plain errors", func() {
+			red := Redact(Plainify(ann(myError("joe@example.com"), "failed")))
+			So(red.Error(), ShouldEqual, "failed: <email>")
+		})
+
+		Convey("does not leak through foreign wrappers", func() {
+			red := Redact(fmt.Errorf("ctx: %w", rsn("user bob@example.com")))
+			So(red.Error(), ShouldNotContainSubstring, "bob@")
+			So(Brief(red), ShouldNotContainSubstring, "bob@")
+			So(Plainify(red).Error(), ShouldNotContainSubstring, "bob@")
+			So(Info(red).Message, ShouldNotContainSubstring, "bob@")
+			So(Brief(red), ShouldEqual, "ctx: user <email>")
+			So(Plainify(ann(red, "outer")).Error(), ShouldEqual, "outer: ctx: user <email>")
+			So(Info(red).Message, ShouldEqual, "ctx: user <email>")
+		})
+
+		Convey("keeps the templates", func() {
+			err := ann(Reason("user %s", "bob@example.com"), "failed %d", 1)
+			red := Redact(err)
+			So(red.Error(), ShouldContainSubstring, "user <email>")
+			So(Summary(red), ShouldEqual, "failed %d")
+			So(Summary(Redact(Reason("user %s", "bob"))), ShouldEqual, "user %s")
+			So(SameTemplate(red, err), ShouldBeTrue)
+			So(Fingerprint(red), ShouldEqual, Fingerprint(err))
+		})
+	})
+
+	Convey("RemoveLayers works", t, func() {
+		root := myError("root")
+		inner := ann(root, "inner")
+		query := ann(WithTags(inner, "db"), "query: SELECT")
+		outer := ann(query, "outer")
+		isQuery := func(e error) bool { return e == query }
+		never := func(e error) bool { return false }
+
+		Convey("nil stays nil", func() {
+			So(RemoveLayers(nil, isQuery), ShouldBeNil)
+		})
+
+		Convey("removes a middle layer", func() {
+			err := RemoveLayers(outer, isQuery)
+			So(err.Error(), ShouldNotContainSubstring, "SELECT")
+			So(err.Error(), ShouldContainSubstring, "() outer\n")
+			So(err.Error(), ShouldContainSubstring, "() inner\nroot")
+			So(Is(err, root), ShouldBeTrue)
+			So(HasTag(err, "db"), ShouldBeTrue)
+			So(outer.Error(), ShouldContainSubstring, "SELECT")
+		})
+
+		Convey("removes the outermost layer", func() {
+			So(RemoveLayers(query, isQuery), ShouldEqual, query.(*annotatedError).orig)
+		})
+
+		Convey("keeps the root cause", func() {
+			So(RemoveLayers(root, func(error) bool { return true }), ShouldEqual, root)
+			r := rsn("because")
+			err := RemoveLayers(ann(r, "outer"), func(e error) bool { return e == r })
+			So(err.Error(), ShouldContainSubstring, "() because")
+		})
+
+		Convey("keeps the chain when nothing is removed", func() {
+			So(RemoveLayers(outer, never), ShouldEqual, outer)
+		})
+
+		Convey("rebuilds plain errors", func() {
+			err := RemoveLayers(Plainify(outer), isQuery)
+			So(err.Error(), ShouldEqual, "outer: inner: root")
+		})
+
+		Convey("removes layers inside foreign wrappers", func() {
+			sql := ann(rsn("root"), "SELECT secret")
+			isSQL := func(e error) bool { return e == sql }
+			err := RemoveLayers(ann(&wrapError{orig: sql}, "outer"), isSQL)
+			So(err.Error(), ShouldNotContainSubstring, "SELECT")
+			So(Plainify(err).Error(), ShouldEqual, "outer: wrap: root")
+
+			joined := fmt.Errorf("ctx: %w; %w", sql, root)
+			err = RemoveLayers(joined, isSQL)
+			So(err.Error(), ShouldNotContainSubstring, "SELECT")
+			So(Plainify(err).Error(), ShouldEqual, "ctx: root; root")
+			So(Is(err, root), ShouldBeTrue)
+			So(RemoveLayers(joined, never), ShouldEqual, joined)
+		})
+	})
+}
@@ -0,0 +1,576 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Frame is a source code location captured by an annotation or a panic.
+type Frame struct {
+	File     string
+	Line     int
+	Function string
+}
+
+// Renderer converts errors to strings. Implementations outside of this package
+// inspect the layers of the chain created by this package with LayerOf.
+type Renderer interface {
+	// RenderError renders the error together with its "Unwrap" chain.
+	RenderError(err error) string
+	// RenderStack renders the call stack of a recovered panic, outermost call
+	// first. It is used for the panic layers of the chain by TextRenderer, and
+	// for the stacks rendered on their own, e.g. by Attributes.
+	RenderStack(frames []Frame) string
+}
+
+// Layer is a read-only view of a single layer of an error chain created by this
+// package, for implementing a custom Renderer.
+type Layer struct {
+	Frame   Frame   // location of the annotation, zero if unknown
+	Skip    int     // stack level of an unknown location, see ReasonStack
+	Message string  // annotation message, "" if none
+	Stack   []Frame // panic call stack for the layers produced by FromPanic
+	Repeats int     // number of identical annotations collapsed into this one
+	Also    error   // secondary error, see AnnotateWith2
+}
+
+// LayerOf returns the Layer view of err if it is a layer created by this
+// package, other than metadata (see e.g. WithTags). The rest of the chain is
+// obtained by unwrapping err as usual.
+func LayerOf(err error) (Layer, bool) {
+	e, ok := err.(*annotatedError)
+	if !ok || e == nil {
+		return Layer{}, false
+	}
+	return Layer{
+		Frame:   e.frame,
+		Skip:    e.skip,
+		Message: e.message(),
+		Stack:   e.stack,
+		Repeats: e.repeats,
+		Also:    e.also,
+	}, true
+}
+
+var (
+	argFormattersMu sync.RWMutex
+	argFormatters   []func(any) (string, bool)
+)
+
+// RegisterArgFormatter registers a function to render message arguments of
+// type T, e.g. to keep messages with complex domain types concise. The result
+// of f replaces the argument before formatting the message, so it is expected
+// to be used with %s or %v verbs. When several formatters match an argument,
+// the first registered one is used. Formatters are applied when the error is
+// rendered, and are intended to be registered at program startup.
+func RegisterArgFormatter[T any](f func(T) string) {
+	argFormattersMu.Lock()
+	defer argFormattersMu.Unlock()
+	argFormatters = append(argFormatters, func(arg any) (string, bool) {
+		v, ok := arg.(T)
+		if !ok {
+			return "", false
+		}
+		return f(v), true
+	})
+}
+
+// formatArgs applies the registered formatters to args. The args slice is
+// returned unchanged if no formatters apply.
+func formatArgs(args []any) []any {
+	argFormattersMu.RLock()
+	defer argFormattersMu.RUnlock()
+	if len(argFormatters) == 0 {
+		return args
+	}
+	var res []any // copy of args, allocated on first replacement
+	for i, arg := range args {
+		for _, f := range argFormatters {
+			if s, ok := f(arg); ok {
+				if res == nil {
+					res = append([]any(nil), args...)
+				}
+				res[i] = s
+				break
+			}
+		}
+	}
+	if res == nil {
+		return args
+	}
+	return res
+}
+
+// TextRenderer is the standard Renderer producing one line per annotation.
+type TextRenderer struct {
+	ErrorPrefix string // prefix of an annotation line
+	PanicPrefix string // prefix of a panic stack line
+	Separator   string // separator between lines
+}
+
+var _ Renderer = TextRenderer{}
+
+// DefaultRenderer is used by all the errors created in this package to
+// implement Error(). It is intended to be set once at program startup, before
+// any errors are rendered.
+var DefaultRenderer Renderer = TextRenderer{
+	ErrorPrefix: "ERROR: ",
+	PanicPrefix: "PANIC: ",
+	Separator:   "\n",
+}
+
+// RenderError implements Renderer. Parts of the chain rendering as empty
+// strings, such as an original error with an empty message, are skipped along
+// with their separators. Secondary errors (see AnnotateWith2) are appended after
+// the chain as "(also: ...)" notes.
+func (r TextRenderer) RenderError(err error) string {
+	var b strings.Builder
+	var also []error
+	sep := func() {
+		if b.Len() > 0 {
+			b.WriteString(r.Separator)
+		}
+	}
+	for err != nil {
+		e, ok := err.(*annotatedError)
+		if e == nil && ok {
+			break
+		}
+		if !ok {
+			if msg := err.Error(); msg != "" {
+				sep()
+				b.WriteString(msg)
+			}
+			break
+		}
+		switch {
+		case e.stack == nil:
+			sep()
+			r.writeAnnotation(&b, e)
+		case len(e.stack) > 0:
+			sep()
+			b.WriteString(r.RenderStack(e.stack))
+		}
+		if e.also != nil {
+			also = append(also, e.also)
+		}
+		err = e.orig
+	}
+	for _, a := range also {
+		if s := r.RenderError(a); s != "" {
+			sep()
+			b.WriteString("(also: ")
+			b.WriteString(s)
+			b.WriteString(")")
+		}
+	}
+	return b.String()
+}
+
+// RenderStack implements Renderer.
+func (r TextRenderer) RenderStack(frames []Frame) string {
+	var b strings.Builder
+	r.writeStack(&b, frames)
+	return b.String()
+}
+
+func (r TextRenderer) writeStack(b *strings.Builder, frames []Frame) {
+	head, tail := frames, []Frame(nil)
+	if limit := maxPanicFrames.get(); limit > 0 && len(frames) > limit {
+		head, tail = frames[:(limit+1)/2], frames[len(frames)-limit/2:]
+	}
+	for i, f := range head {
+		if i > 0 {
+			b.WriteString(r.Separator)
+		}
+		b.WriteString(r.PanicPrefix)
+		r.writeFrame(b, f)
+	}
+	if tail == nil {
+		return
+	}
+	b.WriteString(r.Separator)
+	b.WriteString(r.PanicPrefix)
+	fmt.Fprintf(b, "... %d frames omitted ...", len(frames)-len(head)-len(tail))
+	for _, f := range tail {
+		b.WriteString(r.Separator)
+		b.WriteString(r.PanicPrefix)
+		r.writeFrame(b, f)
+	}
+}
+
+func (r TextRenderer) writeFrame(b *strings.Builder, f Frame) {
+	if LocationStyle(locationStyle.get()) == FuncLine {
+		b.WriteString(f.Function[strings.LastIndexByte(f.Function, '/')+1:])
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(f.Line))
+		writeRevision(b)
+		b.WriteByte(':')
+		return
+	}
+	file := f.File
+	if normalizeSeparators.get() {
+		file = strings.ReplaceAll(file, `\`, "/")
+	}
+	if LocationStyle(locationStyle.get()) == FileLine {
+		file = file[strings.LastIndexAny(file, `/\`)+1:]
+	}
+	b.WriteString(file)
+	b.WriteByte(':')
+	b.WriteString(strconv.Itoa(f.Line))
+	writeRevision(b)
+	b.WriteString(": ")
+	b.WriteString(f.Function)
+	b.WriteString("()")
+}
+
+// writeRevision renders "@<short revision>" of the binary when IncludeRevision
+// is enabled and the revision is known.
+func writeRevision(b *strings.Builder) {
+	if !includeRevision.get() {
+		return
+	}
+	rev := currentBuildInfo().revision
+	if rev == "" {
+		return
+	}
+	if len(rev) > 7 {
+		rev = rev[:7]
+	}
+	b.WriteByte('@')
+	b.WriteString(rev)
+}
+
+// writeAnnotation renders the current annotation without the original error.
+func (r TextRenderer) writeAnnotation(b *strings.Builder, e *annotatedError) {
+	msg := e.message()
+	if duplicateLocation(e) {
+		if msg == "" {
+			// Avoid a dangling space when nothing follows the prefix.
+			b.WriteString(strings.TrimSuffix(r.ErrorPrefix, " "))
+		} else {
+			b.WriteString(r.ErrorPrefix)
+			b.WriteString(msg)
+		}
+	} else {
+		b.WriteString(r.ErrorPrefix)
+		switch {
+		case e.frame != Frame{}:
+			r.writeFrame(b, e.frame)
+		case e.skip != 0:
+			fmt.Fprintf(b, "???(stack=%d):", e.skip)
+		default:
+			b.WriteString("???:")
+		}
+		if msg != "" {
+			b.WriteByte(' ')
+			b.WriteString(msg)
+		}
+	}
+	if e.repeats > 0 {
+		fmt.Fprintf(b, " (x%d)", e.repeats+1)
+	}
+}
+
+// duplicateLocation reports whether the location of the annotation is to be
+// omitted as the same as its original error's, see SuppressDuplicateLocations.
+func duplicateLocation(e *annotatedError) bool {
+	if !suppressDuplicateLocations.get() || e.frame == (Frame{}) {
+		return false
+	}
+	orig, ok := e.orig.(*annotatedError)
+	return ok && orig != nil && orig.stack == nil && orig.frame == e.frame
+}
+
+// plainError renders the messages of the original error without locations.
+type plainError struct {
+	orig error
+}
+
+// Error implements error.
+func (e *plainError) Error() string {
+	var msgs, also []string
+	for err := e.orig; err != nil; {
+		switch v := err.(type) {
+		case *annotatedError:
+			if v == nil {
+				err = nil
+				break
+			}
+			if msg := v.message(); msg != "" {
+				msgs = append(msgs, msg)
+			}
+			if v.also != nil {
+				also = append(also, " (also: "+(&plainError{orig: v.also}).Error()+")")
+			}
+			err = v.orig
+		case *valueError:
+			err = v.orig
+		default:
+			msgs = append(msgs, foreignMessage(err, func(e error) string {
+				return (&plainError{orig: e}).Error()
+			}))
+			err = nil
+		}
+	}
+	return strings.Join(msgs, ": ") + strings.Join(also, "")
+}
+
+// foreignMessage returns the message of an error not created by this package
+// with the rendering of each annotated error it wraps replaced by f of that
+// error, so that no locations leak through, e.g. "ctx: root" for
+// fmt.Errorf("ctx: %w", Reason("root")). If a wrapped error's rendering is not
+// part of the message, the message is replaced by f of the wrapped errors
+// joined by newlines, losing the wrapper's own text.
+func foreignMessage(err error, f func(error) string) string {
+	if _, ok := err.(*validationError); ok {
+		return err.Error() // already without locations
+	}
+	var from, to []string
+	for _, e := range wrappedErrors(err) {
+		if e == nil {
+			continue
+		}
+		full := e.Error()
+		from = append(from, full)
+		if hasAnnotation(e) {
+			to = append(to, f(e))
+		} else {
+			to = append(to, full)
+		}
+	}
+	return replaceMessages(err.Error(), from, to)
+}
+
+// wrappedErrors returns the errors directly wrapped by err. For a redacted
+// error, these are the redacted versions of the wrapped errors.
+func wrappedErrors(err error) []error {
+	switch u := err.(type) {
+	case *redactedError:
+		return u.wrapped // never render the unredacted original
+	case interface{ Unwrap() error }:
+		return []error{u.Unwrap()}
+	case interface{ Unwrap() []error }:
+		return u.Unwrap()
+	}
+	return nil
+}
+
+// replaceMessages replaces the renderings from of the wrapped errors in msg by
+// the respective renderings to. If some changed rendering is not part of msg,
+// returns all of to joined by newlines instead.
+func replaceMessages(msg string, from, to []string) string {
+	for i := range from {
+		if from[i] == to[i] {
+			continue
+		}
+		j := strings.Index(msg, from[i])
+		if from[i] == "" || j < 0 {
+			return strings.Join(to, "\n")
+		}
+		msg = msg[:j] + to[i] + msg[j+len(from[i]):]
+	}
+	return msg
+}
+
+// hasAnnotation reports whether err's tree contains an annotated error.
+func hasAnnotation(err error) bool {
+	return walk(err, func(e error) bool {
+		_, ok := e.(*annotatedError)
+		return ok
+	})
+}
+
+// Unwrap returns the original error.
+func (e *plainError) Unwrap() error {
+	return e.orig
+}
+
+// Plainify returns an error whose message consists of the messages of err's
+// annotations joined by ": ", without locations or panic stacks, e.g. to be
+// returned from a public API. Annotated errors wrapped by errors of other
+// packages, such as fmt.Errorf with %w or multi-errors, are rendered without
+// locations as well. The original chain remains available to Is and
+// As. If err is nil, returns nil.
+func Plainify(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &plainError{orig: err}
+}
+
+// Brief returns the outermost non-empty message of err's chain, without the
+// location or any other part of the chain, e.g. "cannot open config" for a
+// status line. The message of an error from another package wrapping annotated
+// errors has their renderings replaced by their Brief messages, e.g. "ctx: root"
+// for fmt.Errorf("ctx: %w", Reason("root")). Returns "" for a nil error.
+func Brief(err error) string {
+	for err != nil {
+		switch v := err.(type) {
+		case *annotatedError:
+			if v == nil {
+				return ""
+			}
+			if msg := v.message(); msg != "" {
+				return msg
+			}
+			err = v.orig
+		case *valueError:
+			err = v.orig
+		default:
+			return foreignMessage(err, Brief)
+		}
+	}
+	return ""
+}
+
+// Report renders a multi-error, i.e. one implementing Unwrap() []error, as a
+// list of its branches sorted by message, one "- " bullet per branch, with
+// multi-line messages indented. Any other error is rendered as a single bullet.
+// The result does not depend on the order of the branches, e.g. for assertions
+// on errors collected concurrently. Returns "" for a nil error.
+func Report(err error) string {
+	if err == nil {
+		return ""
+	}
+	var msgs []string
+	if m, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range m.Unwrap() {
+			if e != nil {
+				msgs = append(msgs, e.Error())
+			}
+		}
+	} else {
+		msgs = []string{err.Error()}
+	}
+	sort.Strings(msgs)
+	var b strings.Builder
+	for i, msg := range msgs {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString("- ")
+		b.WriteString(strings.ReplaceAll(msg, "\n", "\n  "))
+	}
+	return b.String()
+}
+
+// TreeString renders err as a tree for terminal display: annotations and panic
+// stacks are rendered one per line as by DefaultRenderer (if it is a
+// TextRenderer) followed by their own fields, if any, as "{key=value, ...}".
+// A multi-error, i.e. one implementing Unwrap() []error, branches into its
+// errors with box-drawing connectors. Chains without branches are not
+// indented, to keep deep chains narrow. Secondary errors (see AnnotateWith2)
+// are shown as "also:" branches after the end of the primary chain, following
+// the branches of its multi-error, if any. Returns "" for a nil error.
+func TreeString(err error) string {
+	r, ok := DefaultRenderer.(TextRenderer)
+	if !ok {
+		r = TextRenderer{ErrorPrefix: "ERROR: ", PanicPrefix: "PANIC: "}
+	}
+	r.Separator = "\n"
+	var b strings.Builder
+	r.writeTree(&b, err, "", "")
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// writeTree renders the tree of err, starting the first line with the prefix
+// first, and the rest of the lines with the prefix rest. The secondary errors
+// of the chain are rendered after it as its last "also:" branches.
+func (r TextRenderer) writeTree(b *strings.Builder, err error, first, rest string) {
+	prefix := first
+	writeLines := func(s string) {
+		for _, l := range strings.Split(s, "\n") {
+			b.WriteString(prefix)
+			b.WriteString(l)
+			b.WriteByte('\n')
+			prefix = rest
+		}
+	}
+	var branches, also []error
+	for err != nil {
+		switch v := err.(type) {
+		case *annotatedError:
+			if v == nil {
+				err = nil
+				break
+			}
+			var lb strings.Builder
+			if v.stack == nil {
+				r.writeAnnotation(&lb, v)
+				writeFields(&lb, v.fields)
+			} else {
+				r.writeStack(&lb, v.stack)
+			}
+			if lb.Len() > 0 {
+				writeLines(lb.String())
+			}
+			if v.also != nil {
+				also = append(also, v.also)
+			}
+			err = v.orig
+		case *valueError:
+			err = v.orig
+		case interface{ Unwrap() []error }:
+			for _, e := range v.Unwrap() {
+				if e != nil {
+					branches = append(branches, e)
+				}
+			}
+			writeLines(fmt.Sprintf("%d errors:", len(branches)))
+			err = nil
+		default:
+			writeLines(err.Error())
+			err = nil
+		}
+	}
+	n := len(branches) + len(also)
+	for i, e := range append(branches, also...) {
+		label := ""
+		if i >= len(branches) {
+			label = "also: "
+		}
+		if i == n-1 {
+			r.writeTree(b, e, rest+"└── "+label, rest+"    ")
+		} else {
+			r.writeTree(b, e, rest+"├── "+label, rest+"│   ")
+		}
+	}
+}
+
+// writeFields renders the fields sorted by key as " {key=value, ...}".
+func writeFields(b *strings.Builder, fields map[string]any) {
+	if len(fields) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b.WriteString(" {")
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(b, "%s=%v", k, fields[k])
+	}
+	b.WriteByte('}')
+}
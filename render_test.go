@@ -0,0 +1,289 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// lineRenderer renders the chain on one line, as an external Renderer would.
+type lineRenderer struct{}
+
+func (r lineRenderer) RenderError(err error) string {
+	var parts []string
+	for err != nil {
+		u, wrapper := err.(interface{ Unwrap() error })
+		l, ok := LayerOf(err)
+		switch {
+		case !ok:
+			if !wrapper { // skip metadata
+				parts = append(parts, err.Error())
+			}
+		case l.Stack != nil:
+			parts = append(parts, r.RenderStack(l.Stack))
+		case l.Frame != Frame{}:
+			parts = append(parts, fmt.Sprintf("%s:%d %s", l.Frame.File, l.Frame.Line, l.Message))
+		default:
+			parts = append(parts, l.Message)
+		}
+		if !wrapper {
+			break
+		}
+		err = u.Unwrap()
+	}
+	return strings.Join(parts, " <- ")
+}
+
+func (r lineRenderer) RenderStack(frames []Frame) string {
+	var fs []string
+	for _, f := range frames {
+		fs = append(fs, f.Function)
+	}
+	return "[" + strings.Join(fs, " ") + "]"
+}
+
+func TestRender(t *testing.T) {
+	Convey("Rendering works", t, func() {
+		err := &annotatedError{
+			orig: &annotatedError{
+				orig: &annotatedError{
+					orig:   myError("root"),
+					frame:  Frame{File: "a.go", Line: 1, Function: "pkg.A"},
+					format: "failed a",
+				},
+				stack: []Frame{
+					{File: "b.go", Line: 2, Function: "pkg.B"},
+					{File: "c.go", Line: 3, Function: "pkg.C"},
+				},
+			},
+			format: "no location",
+		}
+
+		Convey("with the default renderer", func() {
+			So(err.Error(), ShouldEqual, `ERROR: ???: no location
+PANIC: b.go:2: pkg.B()
+PANIC: c.go:3: pkg.C()
+ERROR: a.go:1: pkg.A() failed a
+root`)
+		})
+
+		Convey("with a custom renderer", func() {
+			saved := DefaultRenderer
+			defer func() { DefaultRenderer = saved }()
+			DefaultRenderer = TextRenderer{
+				ErrorPrefix: "E ",
+				PanicPrefix: "P ",
+				Separator:   " | ",
+			}
+			So(err.Error(), ShouldEqual,
+				"E ???: no location | P b.go:2: pkg.B() | P c.go:3: pkg.C() | E a.go:1: pkg.A() failed a | root")
+		})
+
+		Convey("with a renderer using only the exported API", func() {
+			saved := DefaultRenderer
+			defer func() { DefaultRenderer = saved }()
+			DefaultRenderer = lineRenderer{}
+			So(err.Error(), ShouldEqual, "no location <- [pkg.B pkg.C] <- a.go:1 failed a <- root")
+			l, ok := LayerOf(err.orig.(*annotatedError).orig)
+			So(ok, ShouldBeTrue)
+			So(l, ShouldResemble, Layer{
+				Frame:   Frame{File: "a.go", Line: 1, Function: "pkg.A"},
+				Message: "failed a",
+			})
+			_, ok = LayerOf(myError("root"))
+			So(ok, ShouldBeFalse)
+			_, ok = LayerOf((*annotatedError)(nil))
+			So(ok, ShouldBeFalse)
+		})
+	})
+
+	Convey("Rendering skips empty parts", t, func() {
+		loc := Frame{File: "a.go", Line: 1, Function: "pkg.A"}
+
+		Convey("location-only layer", func() {
+			err := &annotatedError{orig: myError("root"), frame: loc}
+			So(err.Error(), ShouldEqual, "ERROR: a.go:1: pkg.A()\nroot")
+		})
+
+		Convey("original error with an empty message", func() {
+			err := &annotatedError{orig: myError(""), frame: loc, format: "failed"}
+			So(err.Error(), ShouldEqual, "ERROR: a.go:1: pkg.A() failed")
+		})
+
+		Convey("empty panic stack", func() {
+			err := &annotatedError{
+				orig:  &annotatedError{orig: myError("root"), frame: loc, format: "failed"},
+				stack: []Frame{},
+			}
+			So(err.Error(), ShouldEqual, "ERROR: a.go:1: pkg.A() failed\nroot")
+		})
+
+		Convey("secondary error with an empty message", func() {
+			err := &annotatedError{orig: myError("root"), frame: loc, also: myError("")}
+			So(err.Error(), ShouldEqual, "ERROR: a.go:1: pkg.A()\nroot")
+		})
+	})
+
+	Convey("Plainify works", t, func() {
+		Convey("nil stays nil", func() {
+			So(Plainify(nil), ShouldBeNil)
+		})
+
+		Convey("strips locations", func() {
+			root := myError("root")
+			err := Plainify(ann(WithSampleKey(ann(root, "inner %d", 1), "key"), "outer"))
+			So(err.Error(), ShouldEqual, "outer: inner 1: root")
+			So(Is(err, root), ShouldBeTrue)
+			var e myError
+			So(As(err, &e), ShouldBeTrue)
+		})
+
+		Convey("skips panic stacks and empty messages", func() {
+			So(Plainify(ann(fnA("error"), "")).Error(), ShouldEqual, "error in fnC")
+		})
+
+		Convey("strips locations inside foreign wrappers", func() {
+			root := rsn("root")
+			So(Plainify(fmt.Errorf("ctx: %w", root)).Error(), ShouldEqual, "ctx: root")
+			So(Plainify(ann(&wrapError{orig: ann(root, "inner")}, "outer")).Error(),
+				ShouldEqual, "outer: wrap: inner: root")
+			joined := fmt.Errorf("first: %w; second: %w", root, myError("mine"))
+			So(Plainify(joined).Error(), ShouldEqual, "first: root; second: mine")
+			So(Plainify(fmt.Errorf("ctx: %w", myError("mine"))).Error(), ShouldEqual, "ctx: mine")
+		})
+
+		Convey("falls back to the wrapped messages", func() {
+			err := &multiError{errs: []error{rsn("a"), myError("b")}}
+			So(Plainify(err).Error(), ShouldEqual, "a\nb")
+		})
+	})
+
+	Convey("Brief works", t, func() {
+		So(Brief(nil), ShouldEqual, "")
+		So(Brief(ann(rsn("because"), "cannot open %s", "config")), ShouldEqual, "cannot open config")
+		So(Brief(ann(WithSampleKey(ann(rsn("because"), " "), "key"), "")), ShouldEqual, "because")
+		So(Brief(fnA("error")), ShouldEqual, "error in fnC")
+		So(Brief(ann(myError("mine"), "")), ShouldEqual, "mine")
+		So(Brief(fmt.Errorf("ctx: %w", ann(rsn("root"), "outer"))), ShouldEqual, "ctx: outer")
+		So(Brief(fmt.Errorf("ctx: %w", myError("mine"))), ShouldEqual, "ctx: mine")
+	})
+
+	Convey("RegisterArgFormatter works", t, func() {
+		type point struct{ x, y int }
+		defer func() { argFormatters = nil }()
+		args := []any{point{1, 2}, 3}
+		err := ann(myError("mine"), "at %v, %d", args...)
+		So(err.Error(), ShouldContainSubstring, "ann() at {1 2}, 3\n")
+
+		RegisterArgFormatter(func(p point) string { return fmt.Sprintf("(%d, %d)", p.x, p.y) })
+		RegisterArgFormatter(func(p point) string { return "ignored" })
+		RegisterArgFormatter(func(p *point) string { return "pointer" })
+		So(err.Error(), ShouldContainSubstring, "ann() at (1, 2), 3\n")
+		So(ann(myError("mine"), "at %v", &point{}).Error(), ShouldContainSubstring,
+			"ann() at pointer\n")
+		So(args[0], ShouldResemble, point{1, 2})
+	})
+
+	Convey("Report works", t, func() {
+		So(Report(nil), ShouldEqual, "")
+		So(Report(myError("root")), ShouldEqual, "- root")
+
+		loc := Frame{File: "a.go", Line: 1, Function: "pkg.A"}
+		annotated := &annotatedError{orig: myError("root"), frame: loc, format: "failed"}
+		a := &multiError{errs: []error{myError("b"), annotated, nil, myError("a")}}
+		b := &multiError{errs: []error{myError("a"), myError("b"), annotated}}
+		So(Report(a), ShouldEqual, `- ERROR: a.go:1: pkg.A() failed
+  root
+- a
+- b`)
+		So(Report(a), ShouldEqual, Report(b))
+		So(a.Error(), ShouldEqual, "multi")
+	})
+
+	Convey("TreeString works", t, func() {
+		So(TreeString(nil), ShouldEqual, "")
+		So(TreeString(myError("root")), ShouldEqual, "root")
+
+		frame := func(n int) Frame {
+			return Frame{File: "a.go", Line: n, Function: "pkg.A"}
+		}
+		left := &annotatedError{
+			orig:   &annotatedError{orig: myError("left\nroot"), frame: frame(2), format: "inner"},
+			frame:  frame(1),
+			format: "left",
+			fields: map[string]any{"b": "x", "a": 1},
+		}
+		right := &annotatedError{
+			orig:  myError("right root"),
+			stack: []Frame{frame(3), frame(4)},
+		}
+		nested := &multiError{errs: []error{myError("n1"), nil, myError("n2")}}
+		err := &annotatedError{
+			orig: withValue(&annotatedError{
+				orig:   &multiError{errs: []error{left, nested, right}},
+				frame:  frame(5),
+				format: "middle",
+				also:   myError("rollback"),
+			}, tagsKey{}, []string{"t"}),
+			frame:  frame(6),
+			format: "outer",
+		}
+		So(TreeString(err), ShouldEqual, `ERROR: a.go:6: pkg.A() outer
+ERROR: a.go:5: pkg.A() middle
+3 errors:
+├── ERROR: a.go:1: pkg.A() left {a=1, b=x}
+│   ERROR: a.go:2: pkg.A() inner
+│   left
+│   root
+├── 2 errors:
+│   ├── n1
+│   └── n2
+├── PANIC: a.go:3: pkg.A()
+│   PANIC: a.go:4: pkg.A()
+│   right root
+└── also: rollback`)
+
+		Convey("with secondary errors after the primary chain", func() {
+			err := &annotatedError{
+				orig: &annotatedError{
+					orig:   &annotatedError{frame: frame(1), format: "p"},
+					frame:  frame(2),
+					format: "middle",
+					also:   &annotatedError{orig: myError("s root"), frame: frame(3), format: "s"},
+				},
+				frame:  frame(4),
+				format: "outer",
+				also:   myError("t"),
+			}
+			So(TreeString(err), ShouldEqual, `ERROR: a.go:4: pkg.A() outer
+ERROR: a.go:2: pkg.A() middle
+ERROR: a.go:1: pkg.A() p
+├── also: t
+└── also: ERROR: a.go:3: pkg.A() s
+    s root`)
+		})
+
+		Convey("with a custom renderer", func() {
+			saved := DefaultRenderer
+			defer func() { DefaultRenderer = saved }()
+			DefaultRenderer = TextRenderer{ErrorPrefix: "E ", PanicPrefix: "P ", Separator: " | "}
+			So(TreeString(right), ShouldEqual, "P a.go:3: pkg.A()\nP a.go:4: pkg.A()\nright root")
+		})
+	})
+}
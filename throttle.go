@@ -0,0 +1,73 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"sync"
+	"time"
+)
+
+// Overridden in tests.
+var now = time.Now
+
+// throttleState is the error constructed for a key in the current window.
+type throttleState struct {
+	start   time.Time
+	err     error
+	dropped int
+}
+
+var (
+	throttleMu sync.Mutex
+	throttles  = make(map[string]*throttleState)
+)
+
+type droppedKey struct{}
+
+// Throttled constructs the error by calling f at most once per key per window,
+// e.g. to protect hot error paths in tight loops from error storms. Within the
+// window, it returns the error constructed first, tagged with the number of
+// constructions dropped so far (see Dropped). If f returns nil, nothing is
+// recorded and nil is returned.
+//
+// The state of each key is kept for the lifetime of the program, therefore keys
+// must come from a small fixed set. Note, that f must not call Throttled.
+func Throttled(key string, window time.Duration, f func() error) error {
+	throttleMu.Lock()
+	defer throttleMu.Unlock()
+
+	t := now()
+	st, ok := throttles[key]
+	if !ok || t.Sub(st.start) >= window {
+		err := f()
+		if err == nil {
+			return nil
+		}
+		throttles[key] = &throttleState{start: t, err: err}
+		return err
+	}
+	st.dropped++
+	return withValue(st.err, droppedKey{}, st.dropped)
+}
+
+// Dropped returns the number of constructions dropped by Throttled within the
+// current window as of the time err was returned by it.
+func Dropped(err error) (int, bool) {
+	v, ok := lookup(err, droppedKey{})
+	if !ok {
+		return 0, false
+	}
+	return v.(int), true
+}
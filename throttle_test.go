@@ -0,0 +1,73 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestThrottle(t *testing.T) {
+	Convey("Throttled works", t, func() {
+		t0 := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		current := t0
+		now = func() time.Time { return current }
+		defer func() {
+			now = time.Now
+			throttles = make(map[string]*throttleState)
+		}()
+
+		calls := 0
+		f := func() error {
+			calls++
+			return rsn("because")
+		}
+
+		Convey("constructs once per window", func() {
+			first := Throttled("key", time.Minute, f)
+			So(calls, ShouldEqual, 1)
+			_, ok := Dropped(first)
+			So(ok, ShouldBeFalse)
+
+			current = t0.Add(30 * time.Second)
+			for i := 1; i <= 3; i++ {
+				err := Throttled("key", time.Minute, f)
+				So(err.Error(), ShouldEqual, first.Error())
+				So(Is(err, first), ShouldBeTrue)
+				n, ok := Dropped(err)
+				So(ok, ShouldBeTrue)
+				So(n, ShouldEqual, i)
+			}
+			So(calls, ShouldEqual, 1)
+
+			Throttled("other", time.Minute, f)
+			So(calls, ShouldEqual, 2)
+
+			current = t0.Add(time.Minute)
+			err := Throttled("key", time.Minute, f)
+			So(calls, ShouldEqual, 3)
+			_, ok = Dropped(err)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("does not record nil errors", func() {
+			So(Throttled("nil", time.Minute, func() error { return nil }), ShouldBeNil)
+			Throttled("nil", time.Minute, f)
+			So(calls, ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,107 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"strings"
+)
+
+// Validation collects field-level validation failures. The zero value is ready
+// to use:
+//
+//	var v errors.Validation
+//	if name == "" {
+//	  v.Field("name", "must not be empty")
+//	}
+//	if age < 0 {
+//	  v.Field("age", "must be non-negative, got %d", age)
+//	}
+//	return v.Err()
+type Validation struct {
+	fields   []string           // field names in the order of first failure
+	failures map[string][]error // failures by field name
+}
+
+// Field adds a failure of the named field with the caller's location and the
+// message formatted as fmt.Printf(s, args...). The message is also attached to
+// the failure as the "field.<name>" field (see Fields), so that the Fields of
+// the final error include all the failed fields, with their first failures.
+func (v *Validation) Field(name string, s string, args ...any) {
+	e := annotate(nil, 2, s, args...)
+	e.fields = map[string]any{"field." + name: e.message()}
+	if v.failures == nil {
+		v.failures = make(map[string][]error)
+	}
+	if _, ok := v.failures[name]; !ok {
+		v.fields = append(v.fields, name)
+	}
+	v.failures[name] = append(v.failures[name], e)
+}
+
+// Err returns the error with all the failures, or nil if there were none. The
+// error renders one line per field, in the order of their first failure, with
+// the messages of the field's failures joined by "; ", e.g.:
+//
+//	name: must not be empty
+//	age: must be non-negative, got -1; must be an integer
+//
+// The individual failures are reachable as Unwrap() []error. Since the message
+// has no locations, it is used as is by Brief and Plainify, and its template
+// for Summary is "validation failed".
+func (v *Validation) Err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	res := &validationError{fields: append([]string(nil), v.fields...)}
+	res.failures = make(map[string][]error, len(v.failures))
+	for name, errs := range v.failures {
+		res.failures[name] = append([]error(nil), errs...)
+	}
+	return res
+}
+
+// validationError is the immutable result of Validation.
+type validationError struct {
+	fields   []string
+	failures map[string][]error
+}
+
+// Error implements error.
+func (e *validationError) Error() string {
+	var b strings.Builder
+	for i, name := range e.fields {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(name)
+		b.WriteString(": ")
+		for j, err := range e.failures[name] {
+			if j > 0 {
+				b.WriteString("; ")
+			}
+			b.WriteString(err.(*annotatedError).message())
+		}
+	}
+	return b.String()
+}
+
+// Unwrap returns the individual failures, grouped by field.
+func (e *validationError) Unwrap() []error {
+	var errs []error
+	for _, name := range e.fields {
+		errs = append(errs, e.failures[name]...)
+	}
+	return errs
+}
@@ -0,0 +1,68 @@
+// Copyright 2022 Stock Parfait
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidation(t *testing.T) {
+	Convey("Validation works", t, func() {
+		Convey("no failures", func() {
+			var v Validation
+			So(v.Err(), ShouldBeNil)
+		})
+
+		Convey("groups failures by field", func() {
+			var v Validation
+			v.Field("name", "must not be empty")
+			v.Field("age", "must be non-negative, got %d", -1)
+			v.Field("name", "must be ASCII")
+			err := v.Err()
+			So(err.Error(), ShouldEqual,
+				"name: must not be empty; must be ASCII\nage: must be non-negative, got -1")
+
+			errs := err.(interface{ Unwrap() []error }).Unwrap()
+			So(len(errs), ShouldEqual, 3)
+			So(Fields(errs[0]), ShouldResemble, map[string]any{"field.name": "must not be empty"})
+			So(Fields(errs[1]), ShouldResemble, map[string]any{"field.name": "must be ASCII"})
+			So(Fields(errs[2]), ShouldResemble, map[string]any{"field.age": "must be non-negative, got -1"})
+			So(Fields(err), ShouldResemble, map[string]any{
+				"field.name": "must not be empty",
+				"field.age":  "must be non-negative, got -1",
+			})
+			So(errs[0].Error(), ShouldContainSubstring, "validation_test.go:")
+			So(errs[0].Error(), ShouldContainSubstring, "TestValidation")
+			So(Is(err, errs[2]), ShouldBeTrue)
+
+			v.Field("email", "invalid")
+			So(err.Error(), ShouldNotContainSubstring, "email")
+		})
+
+		Convey("renders without locations", func() {
+			var v Validation
+			v.Field("name", "must not be empty")
+			v.Field("age", "must be non-negative, got %d", -1)
+			err := v.Err()
+			So(Brief(err), ShouldEqual, err.Error())
+			So(Plainify(Annotate(err, "invalid request")).Error(), ShouldEqual,
+				"invalid request: name: must not be empty\nage: must be non-negative, got -1")
+			So(Summary(err), ShouldEqual, "validation failed")
+			So(Summary(Annotate(err, "")), ShouldEqual, "validation failed")
+		})
+	})
+}